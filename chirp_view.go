@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// viewChirps converts database chirps into their API representation as seen by the requester:
+// reshares embed the chirp they reshare, hidden chirps lose their content unless the requester
+// moderates, moderators see which chirps were flagged and liked_by_me is set for authenticated requests
+func (cfg *apiConfig) viewChirps(r *http.Request, dbChirps ...database.Chirp) ([]Chirp, error) {
+	moderates := requestHasPermission(r, permissionModerate)
+	chirps := newChirps(dbChirps)
+	viewed := make([]*Chirp, 0, len(chirps))
+	for i := range chirps {
+		viewed = append(viewed, &chirps[i])
+		chirps[i].Flagged = moderates && dbChirps[i].Flagged
+		if chirps[i].Hidden && !moderates {
+			redactChirp(&chirps[i])
+			continue
+		}
+
+		originalID := dbChirps[i].RechirpOf
+		if originalID == 0 {
+			continue
+		}
+
+		dbOriginal, err := cfg.DB.GetChirpsById(originalID)
+		if errors.Is(err, database.ErrNotExist) {
+			// the original was removed, keep only its ID
+			chirps[i].RechirpOf = &Chirp{ID: originalID, Deleted: true}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		original := newChirp(dbOriginal)
+		original.Flagged = moderates && dbOriginal.Flagged
+		if original.Hidden && !moderates {
+			redactChirp(&original)
+		}
+		chirps[i].RechirpOf = &original
+		viewed = append(viewed, &original)
+	}
+
+	err := cfg.setLikedByMe(r, viewed...)
+	if err != nil {
+		return nil, err
+	}
+
+	return chirps, nil
+}
+
+// redactChirp leaves only the place of a hidden chirp, so that the thread around it holds together
+func redactChirp(chirp *Chirp) {
+	chirp.Body = ""
+	chirp.Hashtags = nil
+	chirp.Mentions = []Mention{}
+}
+
+// setLikedByMe fills liked_by_me on the chirps for authenticated requests.
+// Anonymous requests leave the field out.
+func (cfg *apiConfig) setLikedByMe(r *http.Request, chirps ...*Chirp) error {
+	user, ok := optionalUser(r)
+	if !ok {
+		return nil
+	}
+
+	chirpIDs := make([]int, 0, len(chirps))
+	for _, chirp := range chirps {
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+
+	liked, err := cfg.DB.GetLikedChirps(user.ID, chirpIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, chirp := range chirps {
+		likedByMe := liked[chirp.ID]
+		chirp.LikedByMe = &likedByMe
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// contextKey keys the values the middlewares put in the request context
+type contextKey string
+
+const (
+	currentUserKey    contextKey = "currentUser"
+	currentSessionKey contextKey = "currentSession"
+)
+
+var errSuspended = errors.New("user is suspended")
+
+// middlewareAuth only lets through requests carrying a valid access token of an active user
+// and session, and puts them in the request context for currentUser and currentSession
+func (cfg *apiConfig) middlewareAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headerToken, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT")
+			return
+		}
+
+		user, session, err := cfg.authenticate(headerToken)
+		if errors.Is(err, errSuspended) {
+			respondWithError(w, http.StatusForbidden, "Account is suspended")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withCurrentUser(r.Context(), user, session)))
+	})
+}
+
+// middlewareOptionalAuth puts the user of a valid access token in the request context.
+// Requests without one go through anonymously.
+func (cfg *apiConfig) middlewareOptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headerToken, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, session, err := cfg.authenticate(headerToken)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withCurrentUser(r.Context(), user, session)))
+	})
+}
+
+// withCurrentUser returns the context carrying the authenticated user and session
+func withCurrentUser(ctx context.Context, user database.User, session database.Session) context.Context {
+	ctx = context.WithValue(ctx, currentUserKey, user)
+	return context.WithValue(ctx, currentSessionKey, session)
+}
+
+// authenticate returns the active user identified by the access token and its session.
+// Tokens of sessions that were logged out stop working before they expire.
+func (cfg *apiConfig) authenticate(headerToken string) (database.User, database.Session, error) {
+	claims, err := cfg.tokens.Validate(headerToken, auth.TokenUseAccess)
+	if err != nil {
+		return database.User{}, database.Session{}, err
+	}
+	if claims.SessionID == "" {
+		return database.User{}, database.Session{}, errors.New("token has no sid")
+	}
+
+	now := time.Now().UTC()
+	session, err := cfg.DB.GetSession(claims.SessionID)
+	if err != nil {
+		return database.User{}, database.Session{}, err
+	}
+	if session.UserID != claims.UserID || !session.IsActive(now) {
+		return database.User{}, database.Session{}, errors.New("session is not active")
+	}
+
+	user, err := cfg.DB.GetUserByID(claims.UserID)
+	if err != nil {
+		return database.User{}, database.Session{}, err
+	}
+	if user.Suspended {
+		return database.User{}, database.Session{}, errSuspended
+	}
+
+	if now.Sub(session.LastUsedAt) > sessionTouchInterval {
+		err = cfg.DB.TouchSession(session.ID, now)
+		if err != nil {
+			log.Printf("Couldn't record the use of session %s: %s", session.ID, err)
+		}
+		session.LastUsedAt = now
+	}
+
+	return user, session, nil
+}
+
+// currentUser returns the user authenticated by middlewareAuth.
+// Handlers of routes without the middleware must use optionalUser instead.
+func currentUser(r *http.Request) database.User {
+	user, _ := optionalUser(r)
+	return user
+}
+
+// currentSession returns the session of the access token authenticated by middlewareAuth
+func currentSession(r *http.Request) database.Session {
+	session, _ := r.Context().Value(currentSessionKey).(database.Session)
+	return session
+}
+
+// optionalUser returns the user authenticated by middlewareOptionalAuth,
+// or false for anonymous requests
+func optionalUser(r *http.Request) (database.User, bool) {
+	user, ok := r.Context().Value(currentUserKey).(database.User)
+	return user, ok
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
+	"github.com/ric-ram/go-chirpy/internal/mail"
+)
+
+// maxEmailLength is the longest address allowed by RFC 5321
+const maxEmailLength = 254
+
+// emailVerificationLifetime is how long a verification link works
+const emailVerificationLifetime = 24 * time.Hour
+
+var errInvalidEmail = errors.New("Invalid email")
+
+// normalizeEmail checks that email is a single bare address
+// and returns it without surrounding spaces and with its domain lowercased
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if len(email) > maxEmailLength {
+		return "", errInvalidEmail
+	}
+
+	address, err := netmail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return "", errInvalidEmail
+	}
+
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", errInvalidEmail
+	}
+
+	return local + "@" + domain, nil
+}
+
+// sendVerificationEmail mails a link proving that the user owns the email.
+// For an email other than the current one, opening the link switches the user to it.
+func (cfg *apiConfig) sendVerificationEmail(user database.User, email string) error {
+	token, tokenHash, err := auth.NewOneTimeToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.DB.CreateEmailVerification(database.EmailVerification{
+		TokenHash: tokenHash,
+		UserID:    user.ID,
+		Email:     email,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/app/verify-email.html?token=%s", cfg.publicURL, url.QueryEscape(token))
+	cfg.sendMail(mail.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email",
+		Body: fmt.Sprintf("Confirm that %s is the email of your Chirpy account within the next day at:\n%s\n\n"+
+			"If you didn't ask for this, ignore this email.\n", email, link),
+	})
+
+	return nil
+}
+
+// middlewareRequireVerifiedEmail keeps users who haven't verified their email from posting,
+// when the server runs with -require-verified-email
+func (cfg *apiConfig) middlewareRequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.requireVerifiedEmail && !currentUser(r).Verified {
+			respondWithError(w, http.StatusForbidden, "Email is not verified")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
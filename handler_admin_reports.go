@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// ReportsPage is a page of the moderation queue
+type ReportsPage struct {
+	Reports    []Report `json:"reports"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// ReportDetail is a report with the reported chirp and the log of the report
+type ReportDetail struct {
+	Report
+	Chirp   *Chirp         `json:"chirp,omitempty"`
+	Actions []ReportAction `json:"actions"`
+}
+
+// ReportAction is an entry of the log of a report
+type ReportAction struct {
+	ActorID   int       `json:"actor_id"`
+	Action    string    `json:"action"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// reportCursor marks the last report of a moderation queue page
+type reportCursor struct {
+	ID int `json:"id"`
+}
+
+// reportStatuses lists the values of the status query parameter
+var reportStatuses = map[string]database.ReportStatus{
+	"open":     database.ReportOpen,
+	"claimed":  database.ReportClaimed,
+	"resolved": database.ReportResolved,
+}
+
+// reportResolutions lists the resolutions a moderator can close a report with
+var reportResolutions = map[string]database.Resolution{
+	"hide_chirp":   database.ResolutionHideChirp,
+	"suspend_user": database.ResolutionSuspendUser,
+	"dismiss":      database.ResolutionDismiss,
+}
+
+func (cfg *apiConfig) handlerAdminReportsGet(w http.ResponseWriter, r *http.Request) {
+	statusString := r.URL.Query().Get("status")
+	if statusString == "" {
+		statusString = "open"
+	}
+	status, ok := reportStatuses[statusString]
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid report status")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := database.ReportQuery{
+		Status: status,
+		Limit:  page.Limit + 1,
+	}
+	if page.Cursor != "" {
+		cursor := reportCursor{}
+		err = decodeCursor(page.Cursor, &cursor)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query.AfterID = cursor.ID
+	}
+
+	dbReports, err := cfg.DB.GetReports(query)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve reports")
+		return
+	}
+
+	nextCursor := ""
+	if len(dbReports) > page.Limit {
+		dbReports = dbReports[:page.Limit]
+		nextCursor, err = encodeCursor(reportCursor{
+			ID: dbReports[len(dbReports)-1].ID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create cursor")
+			return
+		}
+		setNextLink(w, r, page.Limit, nextCursor)
+	}
+
+	reports := make([]Report, 0, len(dbReports))
+	for _, report := range dbReports {
+		reports = append(reports, newReport(report))
+	}
+
+	respondWithJSON(w, http.StatusOK, ReportsPage{
+		Reports:    reports,
+		NextCursor: nextCursor,
+	})
+}
+
+func (cfg *apiConfig) handlerAdminReportGet(w http.ResponseWriter, r *http.Request) {
+	report, err := cfg.getReportFromParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Report was not found")
+		return
+	}
+
+	cfg.respondWithReport(w, r, http.StatusOK, report)
+}
+
+func (cfg *apiConfig) handlerAdminReportClaim(w http.ResponseWriter, r *http.Request) {
+	moderatorID := currentUser(r).ID
+	report, err := cfg.getReportFromParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Report was not found")
+		return
+	}
+
+	report, err = cfg.DB.ClaimReport(report.ID, moderatorID)
+	if err != nil {
+		respondWithReportError(w, err)
+		return
+	}
+
+	cfg.respondWithReport(w, r, http.StatusOK, report)
+}
+
+func (cfg *apiConfig) handlerAdminReportResolve(w http.ResponseWriter, r *http.Request) {
+	moderatorID := currentUser(r).ID
+
+	type parameters struct {
+		Resolution string `json:"resolution"`
+		Note       string `json:"note"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	resolution, ok := reportResolutions[params.Resolution]
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid resolution")
+		return
+	}
+
+	report, err := cfg.getReportFromParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Report was not found")
+		return
+	}
+	if resolution == database.ResolutionHideChirp && report.ChirpID == 0 {
+		respondWithError(w, http.StatusBadRequest, "Report has no chirp to hide")
+		return
+	}
+
+	// claim the report first so no other moderator acts on it meanwhile
+	if report.Status != database.ReportClaimed || report.ClaimedBy != moderatorID {
+		report, err = cfg.DB.ClaimReport(report.ID, moderatorID)
+		if err != nil {
+			respondWithReportError(w, err)
+			return
+		}
+	}
+
+	// hides the chirp or suspends the user together with the resolution
+	report, err = cfg.DB.ResolveReport(report.ID, moderatorID, resolution, params.Note)
+	if err != nil {
+		respondWithReportError(w, err)
+		return
+	}
+
+	cfg.respondWithReport(w, r, http.StatusOK, report)
+}
+
+// handlerAdminReportUnhide shows again the chirp hidden by the report, when the hiding is overturned
+func (cfg *apiConfig) handlerAdminReportUnhide(w http.ResponseWriter, r *http.Request) {
+	moderatorID := currentUser(r).ID
+
+	type parameters struct {
+		Note string `json:"note"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	report, err := cfg.getReportFromParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Report was not found")
+		return
+	}
+	if report.Status != database.ReportResolved || report.Resolution != database.ResolutionHideChirp {
+		respondWithReportError(w, database.ErrReportNotHidden)
+		return
+	}
+
+	chirp, err := cfg.DB.GetChirpsById(report.ChirpID)
+	if err != nil || chirp.Deleted {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+	if !chirp.Hidden {
+		respondWithError(w, http.StatusConflict, "Chirp is not hidden")
+		return
+	}
+
+	_, err = cfg.DB.SetChirpHidden(chirp.ID, false)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unhide chirp")
+		return
+	}
+
+	report, err = cfg.DB.UnhideReport(report.ID, moderatorID, params.Note)
+	if err != nil {
+		respondWithReportError(w, err)
+		return
+	}
+
+	cfg.respondWithReport(w, r, http.StatusOK, report)
+}
+
+// respondWithReport responds with the report, its chirp and its log
+func (cfg *apiConfig) respondWithReport(w http.ResponseWriter, r *http.Request, code int, report database.Report) {
+	dbActions, err := cfg.DB.GetReportActions(report.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve report")
+		return
+	}
+
+	detail := ReportDetail{
+		Report:  newReport(report),
+		Actions: make([]ReportAction, 0, len(dbActions)),
+	}
+	for _, action := range dbActions {
+		detail.Actions = append(detail.Actions, ReportAction{
+			ActorID:   action.ActorID,
+			Action:    action.Action,
+			Note:      action.Note,
+			CreatedAt: action.CreatedAt,
+		})
+	}
+
+	if report.ChirpID != 0 {
+		dbChirp, err := cfg.DB.GetChirpsById(report.ChirpID)
+		if err != nil && !errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve report")
+			return
+		}
+		if err == nil {
+			chirps, err := cfg.viewChirps(r, dbChirp)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve report")
+				return
+			}
+			detail.Chirp = &chirps[0]
+		}
+	}
+
+	respondWithJSON(w, code, detail)
+}
+
+// respondWithReportError responds to a claim or resolution refused by the database
+func respondWithReportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrReportClaimed):
+		respondWithError(w, http.StatusConflict, "Report is claimed by another moderator")
+	case errors.Is(err, database.ErrReportResolved):
+		respondWithError(w, http.StatusConflict, "Report is already resolved")
+	case errors.Is(err, database.ErrReportNotHidden):
+		respondWithError(w, http.StatusConflict, "Report didn't hide its chirp")
+	case errors.Is(err, database.ErrSuspendStaff):
+		respondWithError(w, http.StatusForbidden, "Moderators and admins can't be suspended")
+	case errors.Is(err, database.ErrNotExist):
+		respondWithError(w, http.StatusNotFound, "Report was not found")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update report")
+	}
+}
+
+// getReportFromParams returns the report identified by the reportID URL parameter
+func (cfg *apiConfig) getReportFromParams(r *http.Request) (database.Report, error) {
+	paramID := chi.URLParam(r, "reportID")
+	reportID, err := strconv.Atoi(paramID)
+	if err != nil {
+		return database.Report{}, err
+	}
+
+	return cfg.DB.GetReport(reportID)
+}
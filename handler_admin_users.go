@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// userRoles lists the roles an admin can give to a user
+var userRoles = map[string]database.Role{
+	"user":      database.RoleUser,
+	"moderator": database.RoleModerator,
+	"admin":     database.RoleAdmin,
+}
+
+func (cfg *apiConfig) handlerAdminUserRolePut(w http.ResponseWriter, r *http.Request) {
+	adminID := currentUser(r).ID
+
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	role, ok := userRoles[params.Role]
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid role")
+		return
+	}
+
+	user, err := cfg.getUserFromParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User was not found")
+		return
+	}
+
+	// keep admins from locking themselves out
+	if user.ID == adminID {
+		respondWithError(w, http.StatusBadRequest, "Admins can't change their own role")
+		return
+	}
+
+	user, err = cfg.DB.SetUserRole(user.ID, role)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, User{
+		ID:          user.ID,
+		Email:       user.Email,
+		Handle:      user.Handle,
+		IsChirpyRed: user.IsChirpRed,
+		Role:        string(user.Role),
+		Verified:    user.Verified,
+	})
+}
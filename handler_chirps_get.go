@@ -1,103 +1,181 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"sort"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/ric-ram/go-chirpy/internal/database"
 )
 
+// ChirpsPage is a page of chirps returned when limit or cursor are sent
+type ChirpsPage struct {
+	Chirps     []Chirp `json:"chirps"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// chirpSortOrders maps the values of the sort query parameter to the database order
+var chirpSortOrders = map[string]struct {
+	sortBy     database.ChirpSort
+	descending bool
+}{
+	"asc":          {database.ChirpSortID, false},
+	"desc":         {database.ChirpSortID, true},
+	"created_asc":  {database.ChirpSortCreated, false},
+	"created_desc": {database.ChirpSortCreated, true},
+	"updated_asc":  {database.ChirpSortUpdated, false},
+	"updated_desc": {database.ChirpSortUpdated, true},
+	"likes":        {database.ChirpSortLikes, true},
+	"likes_asc":    {database.ChirpSortLikes, false},
+	"likes_desc":   {database.ChirpSortLikes, true},
+}
+
 func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
-	defaultSortingOrder := "asc"
+	query, page, err := parseChirpQuery(r, "asc")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// Get the chirp author_id from the query parameters if exists
 	authorIDString := r.URL.Query().Get("author_id")
+	if authorIDString != "" {
+		authorID, err := strconv.Atoi(authorIDString)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+			return
+		}
+		query.AuthorID = authorID
+	}
+
+	cfg.respondWithChirpsPage(w, r, query, page)
+}
 
+// parseChirpQuery reads the sort, time range and pagination query parameters
+func parseChirpQuery(r *http.Request, defaultSortingOrder string) (database.ChirpQuery, pageParams, error) {
 	// Get sorting order from query paramenters if exists
 	sortingOrder := r.URL.Query().Get("sort")
 	if sortingOrder == "" {
 		sortingOrder = defaultSortingOrder
 	}
 
-	// Retrieve the chirps written by the author_id
-	chirps := []Chirp{}
-	dbChirps, err := cfg.manageGetChirps(authorIDString)
+	order, ok := chirpSortOrders[sortingOrder]
+	if !ok {
+		return database.ChirpQuery{}, pageParams{}, errors.New("Invalid sort order")
+	}
+
+	query := database.ChirpQuery{
+		SortBy:     order.sortBy,
+		Descending: order.descending,
+	}
+
+	// Get the creation time range from the query parameters if exists
+	var err error
+	query.Since, err = parseTimeParam(r, "since")
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		return database.ChirpQuery{}, pageParams{}, err
+	}
+	query.Until, err = parseTimeParam(r, "until")
+	if err != nil {
+		return database.ChirpQuery{}, pageParams{}, err
 	}
 
-	for _, chirp := range dbChirps {
-		chirps = append(chirps, Chirp{
-			ID:       chirp.ID,
-			Body:     chirp.Body,
-			AuthorID: chirp.AuthorID,
-		})
+	page, err := parsePageParams(r)
+	if err != nil {
+		return database.ChirpQuery{}, pageParams{}, err
 	}
 
-	sortedChirps := sortChirpsById(chirps, sortingOrder)
+	if page.Cursor != "" {
+		cursor := database.ChirpCursor{}
+		err = decodeCursor(page.Cursor, &cursor)
+		if err != nil {
+			return database.ChirpQuery{}, pageParams{}, err
+		}
+		query.After = &cursor
+	}
 
-	respondWithJSON(w, http.StatusOK, sortedChirps)
+	// Ask for one extra chirp to know if there is a next page
+	if page.Paginated {
+		query.Limit = page.Limit + 1
+	}
 
+	return query, page, nil
 }
 
-func (cfg *apiConfig) handlerChirpsGetById(w http.ResponseWriter, r *http.Request) {
-	paramID := chi.URLParam(r, "chirpID")
-	id, err := strconv.Atoi(paramID)
+// respondWithChirpsPage responds with the chirps selected by the query,
+// as a plain list when the request is not paginated
+func (cfg *apiConfig) respondWithChirpsPage(w http.ResponseWriter, r *http.Request, query database.ChirpQuery, page pageParams) {
+	dbChirps, err := cfg.DB.GetChirpsPage(query)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
 		return
 	}
 
-	chirp, err := cfg.DB.GetChirpsById(id)
+	nextCursor := ""
+	if page.Paginated && len(dbChirps) > page.Limit {
+		dbChirps = dbChirps[:page.Limit]
+		nextCursor, err = encodeCursor(dbChirps[len(dbChirps)-1].Cursor(query.SortBy))
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create cursor")
+			return
+		}
+		setNextLink(w, r, page.Limit, nextCursor)
+	}
+
+	chirps, err := cfg.viewChirps(r, dbChirps...)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+
+	if !page.Paginated {
+		respondWithJSON(w, http.StatusOK, chirps)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, Chirp{
-		ID:       chirp.ID,
-		Body:     chirp.Body,
-		AuthorID: chirp.AuthorID,
+	respondWithJSON(w, http.StatusOK, ChirpsPage{
+		Chirps:     chirps,
+		NextCursor: nextCursor,
 	})
 }
 
-func sortChirpsById(chirps []Chirp, order string) []Chirp {
-	sort.Slice(chirps, func(i, j int) bool {
-		if order == "asc" {
-			return chirps[i].ID < chirps[j].ID
-		} else if order == "desc" {
-			return chirps[i].ID > chirps[j].ID
-		} else {
-			return false
-		}
-	})
+// parseTimeParam reads an RFC 3339 time from the query parameters, zero when absent
+func parseTimeParam(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
 
-	return chirps
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time", name)
+	}
+
+	return t, nil
 }
 
-// manageGetChirps returns list of chirps wheter there is or not an author_id
-func (cfg *apiConfig) manageGetChirps(authorID string) ([]database.Chirp, error) {
-	if authorID != "" {
-		authorId, err := strconv.Atoi(authorID)
-		if err != nil {
-			return []database.Chirp{}, fmt.Errorf("error parsing author id")
-		}
+func (cfg *apiConfig) handlerChirpsGetById(w http.ResponseWriter, r *http.Request) {
+	paramID := chi.URLParam(r, "chirpID")
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
 
-		dbChirps, err := cfg.DB.GetChirpsByAuthorId(authorId)
-		if err != nil {
-			return []database.Chirp{}, fmt.Errorf("couldn't retrieve chirps for the selected author id")
-		}
-		return dbChirps, nil
+	dbChirp, err := cfg.DB.GetChirpsById(id)
+	if err != nil || dbChirp.Deleted || (dbChirp.Hidden && !requestHasPermission(r, permissionModerate)) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
 
-	} else {
-		dbChirps, err := cfg.DB.GetChirps()
-		if err != nil {
-			return []database.Chirp{}, fmt.Errorf("couldn't retrieve chirps")
-		}
-		return dbChirps, nil
+	chirps, err := cfg.viewChirps(r, dbChirp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp")
+		return
 	}
+
+	respondWithJSON(w, http.StatusOK, chirps[0])
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerChirpLikePut(w http.ResponseWriter, r *http.Request) {
+	cfg.handleChirpLike(w, r, cfg.DB.LikeChirp)
+}
+
+func (cfg *apiConfig) handlerChirpLikeDelete(w http.ResponseWriter, r *http.Request) {
+	cfg.handleChirpLike(w, r, cfg.DB.UnlikeChirp)
+}
+
+// handleChirpLike applies a like or unlike of the current user to the chirp in the URL
+func (cfg *apiConfig) handleChirpLike(w http.ResponseWriter, r *http.Request, update func(userID, chirpID int) (database.Chirp, error)) {
+	chirpID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	dbChirp, err := update(currentUser(r).ID, chirpID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update like")
+		return
+	}
+
+	chirps, err := cfg.viewChirps(r, dbChirp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps[0])
+}
@@ -4,102 +4,140 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"strconv"
-	"strings"
+	"time"
 
-	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
+	"github.com/ric-ram/go-chirpy/internal/moderation"
 )
 
 type Chirp struct {
-	ID       int    `json:"id"`
-	Body     string `json:"body"`
-	AuthorID int    `json:"author_id"`
+	ID        int    `json:"id"`
+	Body      string `json:"body"`
+	AuthorID  int    `json:"author_id"`
+	InReplyTo int    `json:"in_reply_to,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+	// Hidden marks a chirp hidden by a moderator, shown without its content to everyone else
+	Hidden bool `json:"hidden,omitempty"`
+	// Flagged marks a chirp matching a flag rule, shown to moderators only
+	Flagged   bool  `json:"flagged,omitempty"`
+	LikeCount int   `json:"like_count"`
+	LikedByMe *bool `json:"liked_by_me,omitempty"`
+	// RechirpOf embeds the chirp reshared by a rechirp or a quote-chirp
+	RechirpOf    *Chirp    `json:"rechirp_of,omitempty"`
+	RechirpCount int       `json:"rechirp_count"`
+	QuoteCount   int       `json:"quote_count"`
+	Hashtags     []string  `json:"hashtags,omitempty"`
+	Mentions     []Mention `json:"mentions"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
-func (cfg *apiConfig) handlerChirpsPost(w http.ResponseWriter, r *http.Request) {
-	// Get header token
-	headerToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT")
-		return
-	}
+// Mention is an @handle of a chirp body resolved to a user.
+// Start and End are offsets in characters of the body, End excluded.
+type Mention struct {
+	UserID int `json:"user_id"`
+	Start  int `json:"start"`
+	End    int `json:"end"`
+}
 
-	// Validate if is access Token
-	validToken, err := auth.ValidateAccessJwtToken(headerToken, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
-		return
+// newChirp converts a database chirp into its API representation
+func newChirp(chirp database.Chirp) Chirp {
+	mentions := make([]Mention, 0, len(chirp.Mentions))
+	for _, mention := range chirp.Mentions {
+		mentions = append(mentions, Mention{
+			UserID: mention.UserID,
+			Start:  mention.Start,
+			End:    mention.End,
+		})
 	}
 
-	// Get current user ID (author)
-	authorIDString, err := auth.GetUserID(validToken)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error getting id from token")
+	return Chirp{
+		ID:           chirp.ID,
+		Body:         chirp.Body,
+		AuthorID:     chirp.AuthorID,
+		InReplyTo:    chirp.InReplyTo,
+		Deleted:      chirp.Deleted,
+		Hidden:       chirp.Hidden,
+		LikeCount:    chirp.LikeCount,
+		RechirpCount: chirp.RechirpCount,
+		QuoteCount:   chirp.QuoteCount,
+		Hashtags:     chirp.Hashtags,
+		Mentions:     mentions,
+		CreatedAt:    chirp.CreatedAt,
+		UpdatedAt:    chirp.UpdatedAt,
 	}
+}
 
-	authorID, err := strconv.Atoi(authorIDString)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error parsing id")
-		return
+// newChirps converts a list of database chirps into their API representation
+func newChirps(dbChirps []database.Chirp) []Chirp {
+	chirps := make([]Chirp, 0, len(dbChirps))
+	for _, chirp := range dbChirps {
+		chirps = append(chirps, newChirp(chirp))
 	}
 
+	return chirps
+}
+
+func (cfg *apiConfig) handlerChirpsPost(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Body string `json:"body"`
+		Body      string `json:"body"`
+		InReplyTo int    `json:"in_reply_to"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
 		return
 	}
 
-	cleanedChirp, err := validateChirp(params.Body)
+	moderated, err := cfg.validateChirp(params.Body)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	cleanedChirp := moderated.Body
 
-	chirp, err := cfg.DB.CreateChirp(cleanedChirp, authorID)
+	mentions, err := cfg.resolveMentions(cleanedChirp)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't resolve mentions")
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, Chirp{
-		ID:       chirp.ID,
-		Body:     chirp.Body,
-		AuthorID: authorID,
+	chirp, err := cfg.DB.CreateChirp(database.CreateChirpParams{
+		Body:      cleanedChirp,
+		AuthorID:  currentUser(r).ID,
+		InReplyTo: params.InReplyTo,
+		Hashtags:  parseHashtags(cleanedChirp),
+		Mentions:  mentions,
+		Flagged:   moderated.Flagged,
 	})
-}
-
-func validateChirp(body string) (string, error) {
-	const maxChirpLength = 140
-	if len(body) > maxChirpLength {
-		return "", errors.New("Chirp is too long")
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusBadRequest, "Chirp being replied to doesn't exist")
+		return
 	}
-
-	profaneWords := map[string]struct{}{
-		"kerfuffle": {},
-		"sharbert":  {},
-		"fornax":    {},
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
+		return
 	}
+	cfg.reportFlaggedChirp(chirp, moderated)
 
-	cleanedBody := getCleanBody(body, profaneWords)
-	return cleanedBody, nil
+	respondWithJSON(w, http.StatusCreated, newChirp(chirp))
 }
 
-func getCleanBody(body string, profaneWords map[string]struct{}) string {
-	bodyWords := strings.Split(body, " ")
+// validateChirp checks the length of a chirp body and runs it through the moderation rules.
+// Rejected chirps return an error; the result holds the masked body and whether it was flagged.
+func (cfg *apiConfig) validateChirp(body string) (moderation.Result, error) {
+	const maxChirpLength = 140
+	if moderation.Length(body) > maxChirpLength {
+		return moderation.Result{}, errors.New("Chirp is too long")
+	}
 
-	for i, word := range bodyWords {
-		loweredWord := strings.ToLower(word)
-		if _, ok := profaneWords[loweredWord]; ok {
-			bodyWords[i] = "****"
-		}
+	result := cfg.moderator.Moderate(body)
+	if result.Rejected {
+		return moderation.Result{}, moderation.ErrRejected
 	}
 
-	cleaned := strings.Join(bodyWords, " ")
-	return cleaned
+	return result, nil
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/ric-ram/go-chirpy/internal/database"
+	"github.com/ric-ram/go-chirpy/internal/moderation"
+)
+
+func (cfg *apiConfig) handlerChirpRechirpPost(w http.ResponseWriter, r *http.Request) {
+	cfg.createReshare(w, r, moderation.Result{})
+}
+
+func (cfg *apiConfig) handlerChirpQuotePost(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	if params.Body == "" {
+		respondWithError(w, http.StatusBadRequest, "Quote-chirps need a body")
+		return
+	}
+
+	moderated, err := cfg.validateChirp(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cfg.createReshare(w, r, moderated)
+}
+
+// createReshare reshares the chirp in the URL as the current user,
+// as a rechirp when the moderated body is empty or as a quote-chirp otherwise
+func (cfg *apiConfig) createReshare(w http.ResponseWriter, r *http.Request, moderated moderation.Result) {
+	body := moderated.Body
+	originalID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	mentions, err := cfg.resolveMentions(body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't resolve mentions")
+		return
+	}
+
+	dbChirp, err := cfg.DB.CreateChirp(database.CreateChirpParams{
+		Body:      body,
+		AuthorID:  currentUser(r).ID,
+		RechirpOf: originalID,
+		Hashtags:  parseHashtags(body),
+		Mentions:  mentions,
+		Flagged:   moderated.Flagged,
+	})
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
+		return
+	}
+	cfg.reportFlaggedChirp(dbChirp, moderated)
+
+	chirps, err := cfg.viewChirps(r, dbChirp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, chirps[0])
+}
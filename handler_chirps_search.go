@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// handlerChirpsSearch returns a page of the chirps matching the q query parameter, best match first.
+// Words between double quotes must appear together as a phrase.
+func (cfg *apiConfig) handlerChirpsSearch(w http.ResponseWriter, r *http.Request) {
+	text := r.URL.Query().Get("q")
+	if strings.TrimSpace(text) == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing search query")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Ask for one extra chirp to know if there is a next page
+	query := database.SearchQuery{
+		Text:  text,
+		Limit: page.Limit + 1,
+	}
+
+	if page.Cursor != "" {
+		cursor := database.SearchCursor{}
+		err = decodeCursor(page.Cursor, &cursor)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query.After = &cursor
+	}
+
+	authorIDString := r.URL.Query().Get("author_id")
+	if authorIDString != "" {
+		authorID, err := strconv.Atoi(authorIDString)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+			return
+		}
+		query.AuthorID = authorID
+	}
+
+	results, err := cfg.DB.SearchChirps(query)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search chirps")
+		return
+	}
+
+	nextCursor := ""
+	if len(results) > page.Limit {
+		results = results[:page.Limit]
+		nextCursor, err = encodeCursor(results[len(results)-1].Cursor())
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create cursor")
+			return
+		}
+		setNextLink(w, r, page.Limit, nextCursor)
+	}
+
+	dbChirps := make([]database.Chirp, 0, len(results))
+	for _, result := range results {
+		dbChirps = append(dbChirps, result.Chirp)
+	}
+	chirps, err := cfg.viewChirps(r, dbChirps...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search chirps")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ChirpsPage{
+		Chirps:     chirps,
+		NextCursor: nextCursor,
+	})
+}
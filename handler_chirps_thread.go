@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// ThreadReply is a chirp in the descendant tree of a thread
+type ThreadReply struct {
+	Chirp
+	// Depth is 1 for direct replies to the thread chirp
+	Depth int `json:"depth"`
+}
+
+// Thread is a chirp with the chirps it replies to and a page of the replies below it
+type Thread struct {
+	Chirp      Chirp         `json:"chirp"`
+	Ancestors  []Chirp       `json:"ancestors"`
+	Replies    []ThreadReply `json:"replies"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// threadCursor marks the last reply of a thread page by its path below the thread chirp
+type threadCursor struct {
+	Path []int `json:"path"`
+}
+
+func (cfg *apiConfig) handlerChirpThreadGet(w http.ResponseWriter, r *http.Request) {
+	paramID := chi.URLParam(r, "chirpID")
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	chirp, err := cfg.DB.GetChirpsById(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := database.ThreadQuery{
+		Limit: page.Limit + 1,
+	}
+	if page.Cursor != "" {
+		cursor := threadCursor{}
+		err = decodeCursor(page.Cursor, &cursor)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query.After = cursor.Path
+	}
+
+	ancestors, err := cfg.DB.GetChirpAncestors(id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve thread")
+		return
+	}
+
+	descendants, err := cfg.DB.GetChirpDescendants(id, query)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve thread")
+		return
+	}
+
+	nextCursor := ""
+	if len(descendants) > page.Limit {
+		descendants = descendants[:page.Limit]
+		nextCursor, err = encodeCursor(threadCursor{
+			Path: descendants[len(descendants)-1].Path,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create cursor")
+			return
+		}
+		setNextLink(w, r, page.Limit, nextCursor)
+	}
+
+	// view the thread chirp, its ancestors and its replies in one go
+	dbChirps := append([]database.Chirp{chirp}, ancestors...)
+	for _, descendant := range descendants {
+		dbChirps = append(dbChirps, descendant.Chirp)
+	}
+	chirps, err := cfg.viewChirps(r, dbChirps...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve thread")
+		return
+	}
+
+	thread := Thread{
+		Chirp:      chirps[0],
+		Ancestors:  chirps[1 : 1+len(ancestors)],
+		Replies:    make([]ThreadReply, 0, len(descendants)),
+		NextCursor: nextCursor,
+	}
+	for i, descendant := range descendants {
+		thread.Replies = append(thread.Replies, ThreadReply{
+			Chirp: chirps[1+len(ancestors)+i],
+			Depth: len(descendant.Path),
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, thread)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// handlerEmailVerify uses the token of a verification link. It doesn't need a login,
+// since links are often opened on another device.
+func (cfg *apiConfig) handlerEmailVerify(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	user, err := cfg.DB.VerifyEmail(auth.HashOneTimeToken(params.Token))
+	if errors.Is(err, database.ErrNotExist) || errors.Is(err, database.ErrTokenExpired) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if errors.Is(err, database.ErrEmailTaken) {
+		respondWithError(w, http.StatusConflict, "Email is already taken")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, User{
+		ID:          user.ID,
+		Email:       user.Email,
+		Handle:      user.Handle,
+		IsChirpyRed: user.IsChirpRed,
+		Role:        string(user.Role),
+		Verified:    user.Verified,
+	})
+}
+
+// handlerEmailVerificationResend mails a new verification link for the current email
+func (cfg *apiConfig) handlerEmailVerificationResend(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user.Verified {
+		respondWithError(w, http.StatusConflict, "Email is already verified")
+		return
+	}
+
+	err := cfg.sendVerificationEmail(user, user.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email")
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, struct{}{})
+}
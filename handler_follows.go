@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// FollowedUser is a user in a followers or following list
+type FollowedUser struct {
+	ID         int       `json:"id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// FollowsPage is a page of a followers or following list
+type FollowsPage struct {
+	Users      []FollowedUser `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// followCursor marks the last user of a follows page
+type followCursor struct {
+	ID int `json:"id"`
+}
+
+func (cfg *apiConfig) handlerFollowPost(w http.ResponseWriter, r *http.Request) {
+	followerID := currentUser(r).ID
+	followee, err := cfg.getUserFromParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User was not found")
+		return
+	}
+
+	if followee.ID == followerID {
+		respondWithError(w, http.StatusBadRequest, "Users can't follow themselves")
+		return
+	}
+
+	follow, err := cfg.DB.FollowUser(followerID, followee.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't follow user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, FollowedUser{
+		ID:         follow.FolloweeID,
+		FollowedAt: follow.CreatedAt,
+	})
+}
+
+func (cfg *apiConfig) handlerFollowDelete(w http.ResponseWriter, r *http.Request) {
+	followerID := currentUser(r).ID
+	followee, err := cfg.getUserFromParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User was not found")
+		return
+	}
+
+	err = cfg.DB.UnfollowUser(followerID, followee.ID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "User is not followed")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unfollow user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+func (cfg *apiConfig) handlerFollowersGet(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithFollows(w, r, cfg.DB.GetFollowers, func(follow database.Follow) int {
+		return follow.FollowerID
+	})
+}
+
+func (cfg *apiConfig) handlerFollowingGet(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithFollows(w, r, cfg.DB.GetFollowing, func(follow database.Follow) int {
+		return follow.FolloweeID
+	})
+}
+
+// respondWithFollows responds with a page of the follows listed by getFollows,
+// showing for each follow the user returned by listedUser
+func (cfg *apiConfig) respondWithFollows(
+	w http.ResponseWriter,
+	r *http.Request,
+	getFollows func(userID int, query database.FollowQuery) ([]database.Follow, error),
+	listedUser func(follow database.Follow) int,
+) {
+	user, err := cfg.getUserFromParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User was not found")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := database.FollowQuery{
+		Limit: page.Limit + 1,
+	}
+	if page.Cursor != "" {
+		cursor := followCursor{}
+		err = decodeCursor(page.Cursor, &cursor)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query.AfterID = cursor.ID
+	}
+
+	follows, err := getFollows(user.ID, query)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve follows")
+		return
+	}
+
+	nextCursor := ""
+	if len(follows) > page.Limit {
+		follows = follows[:page.Limit]
+		nextCursor, err = encodeCursor(followCursor{
+			ID: listedUser(follows[len(follows)-1]),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create cursor")
+			return
+		}
+		setNextLink(w, r, page.Limit, nextCursor)
+	}
+
+	users := make([]FollowedUser, 0, len(follows))
+	for _, follow := range follows {
+		users = append(users, FollowedUser{
+			ID:         listedUser(follow),
+			FollowedAt: follow.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, FollowsPage{
+		Users:      users,
+		NextCursor: nextCursor,
+	})
+}
+
+// getUserFromParams returns the user identified by the userID URL parameter
+func (cfg *apiConfig) getUserFromParams(r *http.Request) (database.User, error) {
+	paramID := chi.URLParam(r, "userID")
+	userID, err := strconv.Atoi(paramID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return cfg.DB.GetUserByID(userID)
+}
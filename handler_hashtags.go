@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+const (
+	defaultTrendingLimit = 10
+	maxTrendingWindow    = 30 * 24 * time.Hour
+)
+
+// TrendingHashtag is a hashtag ranked by its recent usage
+type TrendingHashtag struct {
+	Tag   string  `json:"tag"`
+	Uses  int     `json:"uses"`
+	Score float64 `json:"score"`
+}
+
+// handlerHashtagChirpsGet returns the chirps tagged with the hashtag,
+// newest first unless another sort order is requested
+func (cfg *apiConfig) handlerHashtagChirpsGet(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(strings.TrimPrefix(chi.URLParam(r, "tag"), "#"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid hashtag")
+		return
+	}
+
+	query, page, err := parseChirpQuery(r, "desc")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query.Hashtag = tag
+
+	// Hashtag pages are always paginated
+	if !page.Paginated {
+		page.Paginated = true
+		query.Limit = page.Limit + 1
+	}
+
+	cfg.respondWithChirpsPage(w, r, query, page)
+}
+
+// handlerHashtagsTrendingGet ranks the hashtags used in the trending window,
+// where each use counts half as much every quarter of the window
+func (cfg *apiConfig) handlerHashtagsTrendingGet(w http.ResponseWriter, r *http.Request) {
+	window := cfg.trendingWindow
+	if windowString := r.URL.Query().Get("window"); windowString != "" {
+		var err error
+		window, err = time.ParseDuration(windowString)
+		if err != nil || window <= 0 || window > maxTrendingWindow {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("window must be a duration up to %s", maxTrendingWindow))
+			return
+		}
+	}
+
+	limit := defaultTrendingLimit
+	if limitString := r.URL.Query().Get("limit"); limitString != "" {
+		var err error
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	dbTrending, err := cfg.DB.GetTrendingHashtags(database.TrendingQuery{
+		Since:    now.Add(-window),
+		Until:    now,
+		HalfLife: window / 4,
+		Limit:    limit,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve trending hashtags")
+		return
+	}
+
+	trending := make([]TrendingHashtag, 0, len(dbTrending))
+	for _, hashtag := range dbTrending {
+		trending = append(trending, TrendingHashtag{
+			Tag:   hashtag.Tag,
+			Uses:  hashtag.Uses,
+			Score: hashtag.Score,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, trending)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+)
+
+// handlerMentionsGet returns the chirps mentioning the user,
+// newest first unless another sort order is requested
+func (cfg *apiConfig) handlerMentionsGet(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.getUserFromParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User was not found")
+		return
+	}
+
+	query, page, err := parseChirpQuery(r, "desc")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query.MentionOf = user.ID
+
+	// Mentions are always paginated
+	if !page.Paginated {
+		page.Paginated = true
+		query.Limit = page.Limit + 1
+	}
+
+	cfg.respondWithChirpsPage(w, r, query, page)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
+	"github.com/ric-ram/go-chirpy/internal/mail"
+)
+
+// passwordResetLifetime is how long a password reset link works
+const passwordResetLifetime = time.Hour
+
+// handlerPasswordResetRequest mails a password reset link to the user with the email.
+// It answers the same whether the email is known or not, so it can't be used to find accounts.
+func (cfg *apiConfig) handlerPasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	user, err := cfg.DB.GetUserByEmail(params.Email)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithJSON(w, http.StatusAccepted, struct{}{})
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user")
+		return
+	}
+
+	token, tokenHash, err := auth.NewOneTimeToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create reset token")
+		return
+	}
+
+	_, err = cfg.DB.CreatePasswordReset(database.PasswordReset{
+		TokenHash: tokenHash,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetLifetime),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create reset token")
+		return
+	}
+
+	link := fmt.Sprintf("%s/app/password-reset.html?token=%s", cfg.publicURL, url.QueryEscape(token))
+	cfg.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"Choose a new password within the next hour at:\n%s\n\n"+
+			"If it wasn't you, ignore this email and your password stays the same.\n", link),
+	})
+
+	respondWithJSON(w, http.StatusAccepted, struct{}{})
+}
+
+// handlerPasswordResetConfirm sets the new password of the user of a reset token
+// and logs out every session, in case the account was taken over
+func (cfg *apiConfig) handlerPasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	if params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password is required")
+		return
+	}
+
+	encryptedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Invalid password")
+		return
+	}
+
+	user, err := cfg.DB.ResetPassword(auth.HashOneTimeToken(params.Token), encryptedPassword)
+	if errors.Is(err, database.ErrNotExist) || errors.Is(err, database.ErrTokenExpired) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+
+	_, err = cfg.DB.RevokeUserSessions(user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke the sessions")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
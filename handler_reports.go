@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ric-ram/go-chirpy/internal/database"
+	"github.com/ric-ram/go-chirpy/internal/moderation"
+)
+
+// Report is a chirp or a user reported to the moderators
+type Report struct {
+	ID         int       `json:"id"`
+	ReporterID int       `json:"reporter_id"`
+	ChirpID    int       `json:"chirp_id,omitempty"`
+	UserID     int       `json:"user_id"`
+	Reason     string    `json:"reason"`
+	Details    string    `json:"details,omitempty"`
+	Status     string    `json:"status"`
+	ClaimedBy  int       `json:"claimed_by,omitempty"`
+	Resolution string    `json:"resolution,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// reportReasons lists the reason categories a report can be filed under
+var reportReasons = map[string]bool{
+	"spam":           true,
+	"harassment":     true,
+	"hate":           true,
+	"violence":       true,
+	"self_harm":      true,
+	"misinformation": true,
+	"other":          true,
+}
+
+// reportReasonFlagged is the reason of the reports filed for chirps matching a flag rule.
+// Users can't pick it, and those reports have no reporter.
+const reportReasonFlagged = "flagged"
+
+const maxReportDetailsLength = 500
+
+// newReport converts a database report into its API representation
+func newReport(report database.Report) Report {
+	return Report{
+		ID:         report.ID,
+		ReporterID: report.ReporterID,
+		ChirpID:    report.ChirpID,
+		UserID:     report.UserID,
+		Reason:     report.Reason,
+		Details:    report.Details,
+		Status:     string(report.Status),
+		ClaimedBy:  report.ClaimedBy,
+		Resolution: string(report.Resolution),
+		CreatedAt:  report.CreatedAt,
+		UpdatedAt:  report.UpdatedAt,
+	}
+}
+
+func (cfg *apiConfig) handlerReportsPost(w http.ResponseWriter, r *http.Request) {
+	reporterID := currentUser(r).ID
+
+	type parameters struct {
+		ChirpID int    `json:"chirp_id"`
+		UserID  int    `json:"user_id"`
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	if (params.ChirpID == 0) == (params.UserID == 0) {
+		respondWithError(w, http.StatusBadRequest, "Report either a chirp_id or a user_id")
+		return
+	}
+	if !reportReasons[params.Reason] {
+		respondWithError(w, http.StatusBadRequest, "Invalid report reason")
+		return
+	}
+	if utf8.RuneCountInString(params.Details) > maxReportDetailsLength {
+		respondWithError(w, http.StatusBadRequest, "Report details are too long")
+		return
+	}
+
+	// chirp reports are also held against the author of the chirp
+	reportedUserID := params.UserID
+	if params.ChirpID != 0 {
+		chirp, err := cfg.DB.GetChirpsById(params.ChirpID)
+		if err != nil || chirp.Deleted {
+			respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+			return
+		}
+		reportedUserID = chirp.AuthorID
+	} else {
+		_, err := cfg.DB.GetUserByID(params.UserID)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "User was not found")
+			return
+		}
+	}
+
+	if reportedUserID == reporterID {
+		respondWithError(w, http.StatusBadRequest, "Users can't report themselves")
+		return
+	}
+
+	report, err := cfg.DB.CreateReport(database.CreateReportParams{
+		ReporterID: reporterID,
+		ChirpID:    params.ChirpID,
+		UserID:     reportedUserID,
+		Reason:     params.Reason,
+		Details:    params.Details,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create report")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, newReport(report))
+}
+
+// reportFlaggedChirp files a report for a chirp matching flag rules, so that it reaches the moderation queue.
+// The chirp is already posted by then, so failing to report it is only logged.
+func (cfg *apiConfig) reportFlaggedChirp(chirp database.Chirp, moderated moderation.Result) {
+	if !chirp.Flagged {
+		return
+	}
+
+	words := []string{}
+	for _, rule := range moderated.Matches {
+		if rule.Action == moderation.ActionFlag && !slices.Contains(words, rule.Word) {
+			words = append(words, rule.Word)
+		}
+	}
+
+	_, err := cfg.DB.CreateReport(database.CreateReportParams{
+		ChirpID: chirp.ID,
+		UserID:  chirp.AuthorID,
+		Reason:  reportReasonFlagged,
+		Details: "Matched the flag rules for: " + strings.Join(words, ", "),
+	})
+	if err != nil {
+		log.Printf("Couldn't report flagged chirp %d: %s", chirp.ID, err)
+	}
+}
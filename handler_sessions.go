@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current marks the session of the token listing the sessions
+	Current bool `json:"current"`
+}
+
+func (cfg *apiConfig) handlerSessionsGet(w http.ResponseWriter, r *http.Request) {
+	current := currentSession(r)
+
+	dbSessions, err := cfg.DB.GetUserSessions(currentUser(r).ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve sessions")
+		return
+	}
+
+	sessions := make([]Session, 0, len(dbSessions))
+	for _, session := range dbSessions {
+		sessions = append(sessions, Session{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == current.ID,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+// handlerSessionDelete logs out one session of the user,
+// its refresh and access tokens stop working right away
+func (cfg *apiConfig) handlerSessionDelete(w http.ResponseWriter, r *http.Request) {
+	session, err := cfg.DB.GetSession(chi.URLParam(r, "sessionID"))
+	if err != nil || session.UserID != currentUser(r).ID || !session.IsActive(time.Now().UTC()) {
+		respondWithError(w, http.StatusNotFound, "Session was not found")
+		return
+	}
+
+	err = cfg.DB.RevokeSession(session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke the session")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// handlerLogoutAll logs out every session of the user, including the current one
+func (cfg *apiConfig) handlerLogoutAll(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Revoked int `json:"revoked"`
+	}
+
+	count, err := cfg.DB.RevokeUserSessions(currentUser(r).ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke the sessions")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Revoked: count,
+	})
+}
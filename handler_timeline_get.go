@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+)
+
+// handlerTimelineGet returns the chirps of the current user and of the users they follow,
+// newest first unless another sort order is requested
+func (cfg *apiConfig) handlerTimelineGet(w http.ResponseWriter, r *http.Request) {
+	query, page, err := parseChirpQuery(r, "desc")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query.TimelineOf = currentUser(r).ID
+
+	// The timeline is always paginated
+	if !page.Paginated {
+		page.Paginated = true
+		query.Limit = page.Limit + 1
+	}
+
+	cfg.respondWithChirpsPage(w, r, query, page)
+}
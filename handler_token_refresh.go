@@ -1,17 +1,20 @@
 package main
 
 import (
+	"errors"
 	"net/http"
-	"strconv"
 
 	"github.com/ric-ram/go-chirpy/internal/auth"
 	"github.com/ric-ram/go-chirpy/internal/database"
 )
 
+// handlerTokenRefresh exchanges a refresh token for a new access token and a new refresh token.
+// The old refresh token is used up; presenting it again revokes its whole family.
 func (cfg *apiConfig) handlerTokenRefresh(w http.ResponseWriter, r *http.Request) {
 	// define response type
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	// get header token - if not 401
@@ -22,42 +25,52 @@ func (cfg *apiConfig) handlerTokenRefresh(w http.ResponseWriter, r *http.Request
 	}
 
 	// check if is valid refresh token - if not 401
-	validToken, err := auth.ValidateRefreshJwtToken(headerToken, cfg.jwtSecret)
-	if err != nil {
+	claims, err := cfg.tokens.Validate(headerToken, auth.TokenUseRefresh)
+	if err != nil || claims.ID == "" {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
 		return
 	}
-	if validToken == nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid refresh Token")
+
+	// the role is read again so that role changes apply on refresh
+	user, err := cfg.DB.GetUserByID(claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "User was not found")
 		return
 	}
-
-	// check if token is not revoked - if not 401
-	_, err = cfg.DB.GetRevokedTokenById(headerToken)
-	if err != database.ErrNotExist {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't read database")
+	if user.Suspended {
+		respondWithError(w, http.StatusForbidden, "Account is suspended")
 		return
 	}
 
-	// create new access tokem - 200
-	userIDString, err := auth.GetUserID(validToken)
+	// rotate the refresh token - 401 if it was revoked or already used
+	nextToken, nextJwtToken, err := cfg.newRefreshToken(user)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error getting id from token")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create Refresh JWT")
+		return
+	}
+	nextToken, err = cfg.DB.RotateRefreshToken(claims.ID, nextToken)
+	if errors.Is(err, database.ErrTokenReused) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token was already used")
+		return
+	}
+	if errors.Is(err, database.ErrTokenRevoked) || errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token is revoked")
+		return
 	}
-
-	userID, err := strconv.Atoi(userIDString)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error parsing id")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read database")
 		return
 	}
 
-	newToken, err := auth.CreateJwtToken(userID, cfg.jwtSecret, "access")
+	// create new access token - 200
+	newToken, err := cfg.newAccessToken(user, nextToken.FamilyID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create Access JWT")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		Token: newToken,
+		Token:        newToken,
+		RefreshToken: nextJwtToken,
 	})
 }
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerTokenRevoke(w http.ResponseWriter, r *http.Request) {
@@ -15,16 +17,18 @@ func (cfg *apiConfig) handlerTokenRevoke(w http.ResponseWriter, r *http.Request)
 	}
 
 	// check if is valid refresh token
-	_, err = auth.ValidateRefreshJwtToken(headerToken, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't validate JWT")
+	claims, err := cfg.tokens.Validate(headerToken, auth.TokenUseRefresh)
+	if err != nil || claims.ID == "" {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
 		return
 	}
 
-	// Revoke the token in the database
-	// refreshToken : date of revoken
-	// use refreshToken as id
-	err = cfg.DB.AddRevokeToken(headerToken)
+	// Revoke the session of the token with every token rotated from it
+	err = cfg.DB.RevokeRefreshToken(claims.ID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token is revoked")
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke the token")
 		return
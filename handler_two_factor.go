@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
+	"github.com/ric-ram/go-chirpy/internal/mail"
+	"github.com/ric-ram/go-chirpy/internal/qr"
+)
+
+// handlerTOTPEnroll starts the enrollment of an authenticator app,
+// which stays pending until confirmed with a first code
+func (cfg *apiConfig) handlerTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+		// QRPNG is the provisioning URI as a QR code, base64 encoded in the JSON
+		QRPNG []byte `json:"qr_png"`
+	}
+
+	user := currentUser(r)
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create secret")
+		return
+	}
+
+	_, err = cfg.DB.CreateTOTP(database.TOTP{
+		UserID: user.ID,
+		Secret: secret,
+	})
+	if errors.Is(err, database.ErrTOTPEnabled) {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start two-factor enrollment")
+		return
+	}
+
+	uri := auth.TOTPProvisioningURI(secret, totpIssuer, user.Email)
+	code, err := qr.Encode(uri)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create QR code")
+		return
+	}
+	png, err := code.PNG(qrModulePixels)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create QR code")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Secret:          secret,
+		ProvisioningURI: uri,
+		QRPNG:           png,
+	})
+}
+
+// handlerTOTPConfirm enables two-factor authentication once the user proved
+// the authenticator app works, and hands out the recovery codes, shown this once
+func (cfg *apiConfig) handlerTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	user := currentUser(r)
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	totp, err := cfg.DB.GetTOTP(user.ID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusBadRequest, "Two-factor enrollment was not started")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve two-factor enrollment")
+		return
+	}
+	if totp.Enabled {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	now := time.Now().UTC()
+	if !cfg.twoFactorFailures.allowed(user.ID, now) {
+		respondWithError(w, http.StatusTooManyRequests, errTooManyTwoFactorFailures.Error())
+		return
+	}
+	step, err := auth.ValidateTOTP(totp.Secret, params.Code, now, totpDrift, 0)
+	if err != nil {
+		cfg.twoFactorFailures.fail(user.ID, now)
+		respondWithError(w, http.StatusBadRequest, errInvalidTwoFactorCode.Error())
+		return
+	}
+	cfg.twoFactorFailures.reset(user.ID)
+
+	codes, hashes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes")
+		return
+	}
+
+	_, err = cfg.DB.EnableTOTP(user.ID, step, hashes)
+	if errors.Is(err, database.ErrTOTPEnabled) {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication")
+		return
+	}
+
+	cfg.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Two-factor authentication turned on",
+		Body: "Two-factor authentication was turned on for your Chirpy account. " +
+			"Logging in now takes a code of your authenticator app or one of your recovery codes.\n",
+	})
+
+	respondWithJSON(w, http.StatusOK, response{
+		RecoveryCodes: codes,
+	})
+}
+
+// handlerTOTPDelete turns two-factor authentication off with a last code,
+// or cancels a pending enrollment
+func (cfg *apiConfig) handlerTOTPDelete(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	user := currentUser(r)
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	totp, err := cfg.DB.GetTOTP(user.ID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Two-factor authentication is not enabled")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve two-factor authentication")
+		return
+	}
+
+	if totp.Enabled {
+		err = cfg.checkSecondFactor(totp, params.Code, params.RecoveryCode)
+		if !respondWithSecondFactorError(w, err) {
+			return
+		}
+	}
+
+	err = cfg.DB.DeleteTOTP(user.ID)
+	if err != nil && !errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication")
+		return
+	}
+
+	if totp.Enabled {
+		cfg.sendMail(mail.Message{
+			To:      user.Email,
+			Subject: "Two-factor authentication turned off",
+			Body: "Two-factor authentication was turned off for your Chirpy account.\n" +
+				"If it wasn't you, reset your password and turn it back on.\n",
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// handlerLoginTwoFactor completes the login of a user with two-factor authentication,
+// trading the challenge token of the password step and a code for the tokens
+func (cfg *apiConfig) handlerLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		// RecoveryCode is used instead of Code when the authenticator app is lost
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	claims, err := cfg.tokens.Validate(params.ChallengeToken, auth.TokenUseTwoFactor)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid challenge token")
+		return
+	}
+
+	user, err := cfg.DB.GetUserByID(claims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid challenge token")
+		return
+	}
+	if user.Suspended {
+		respondWithError(w, http.StatusForbidden, "Account is suspended")
+		return
+	}
+
+	totp, err := cfg.DB.GetTOTP(user.ID)
+	if err != nil || !totp.Enabled {
+		// turned off since the password step, which is enough then
+		if err != nil && !errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check two-factor authentication")
+			return
+		}
+		cfg.respondWithLogin(w, r, user)
+		return
+	}
+
+	err = cfg.checkSecondFactor(totp, params.Code, params.RecoveryCode)
+	if !respondWithSecondFactorError(w, err) {
+		return
+	}
+
+	if params.RecoveryCode != "" {
+		cfg.sendMail(mail.Message{
+			To:      user.Email,
+			Subject: "Recovery code used",
+			Body: fmt.Sprintf("A recovery code was used to log in to your Chirpy account from %s.\n"+
+				"If it wasn't you, reset your password.\n", clientIP(r)),
+		})
+	}
+
+	cfg.respondWithLogin(w, r, user)
+}
+
+// respondWithSecondFactorError responds with the error of checkSecondFactor
+// and reports whether the code was accepted
+func respondWithSecondFactorError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errInvalidTwoFactorCode):
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, errTooManyTwoFactorFailures):
+		respondWithError(w, http.StatusTooManyRequests, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check two-factor code")
+	}
+
+	return false
+}
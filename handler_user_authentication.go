@@ -2,19 +2,31 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
 )
 
 type AuthenticatedUser struct {
 	ID           int    `json:"id"`
 	Email        string `json:"email"`
+	Handle       string `json:"handle,omitempty"`
 	IsChirpyRed  bool   `json:"is_chirpy_red"`
+	Role         string `json:"role"`
+	Verified     bool   `json:"verified"`
 	Token        string `json:"token"`
 	RefreshToken string `json:"refresh_token"`
 }
 
+// TwoFactorChallenge answers the correct password of a user with two-factor authentication,
+// the challenge token is exchanged for the tokens at POST /api/login/2fa along with a code
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
 func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Email    string `json:"email"`
@@ -40,23 +52,69 @@ func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusUnauthorized, "Incorrect password")
 		return
 	}
+	if existingUser.Suspended {
+		respondWithError(w, http.StatusForbidden, "Account is suspended")
+		return
+	}
 
-	accessJwtToken, err := auth.CreateJwtToken(existingUser.ID, cfg.jwtSecret, "access")
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create Access JWT")
+	totp, err := cfg.DB.GetTOTP(existingUser.ID)
+	if err != nil && !errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check two-factor authentication")
 		return
 	}
+	if err == nil && totp.Enabled {
+		challengeToken, _, err := cfg.tokens.Issue(auth.Claims{
+			UserID:   existingUser.ID,
+			TokenUse: auth.TokenUseTwoFactor,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create challenge token")
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, TwoFactorChallenge{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+		return
+	}
+
+	cfg.respondWithLogin(w, r, existingUser)
+}
 
-	refreshJwtToken, err := auth.CreateJwtToken(existingUser.ID, cfg.jwtSecret, "refresh")
+// respondWithLogin starts a session for the user, who proved who they are,
+// and responds with its access and refresh tokens
+func (cfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, existingUser database.User) {
+	// every login starts a new session with its own refresh token family
+	session, err := newSession(r, existingUser)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create session")
+		return
+	}
+	refreshToken, refreshJwtToken, err := cfg.newRefreshToken(existingUser)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create Refresh JWT")
 		return
 	}
+	session, err = cfg.DB.CreateSession(session, refreshToken)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create session")
+		return
+	}
+
+	accessJwtToken, err := cfg.newAccessToken(existingUser, session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create Access JWT")
+		return
+	}
 
 	respondWithJSON(w, http.StatusOK, AuthenticatedUser{
 		ID:           existingUser.ID,
 		Email:        existingUser.Email,
+		Handle:       existingUser.Handle,
 		IsChirpyRed:  existingUser.IsChirpRed,
+		Role:         string(existingUser.Role),
+		Verified:     existingUser.Verified,
 		Token:        accessJwtToken,
 		RefreshToken: refreshJwtToken,
 	})
@@ -2,71 +2,111 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
+	"strings"
 
 	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
+	"github.com/ric-ram/go-chirpy/internal/mail"
 )
 
 func (cfg *apiConfig) handlerUserUpdate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
+		// Password, Email and Handle keep their current value when empty
 		Password string `json:"password"`
 		Email    string `json:"email"`
+		Handle   string `json:"handle"`
 	}
 
 	type response struct {
 		User
+		// PendingEmail is the new email waiting to be confirmed from its inbox
+		PendingEmail string `json:"pending_email,omitempty"`
 	}
 
-	headerToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT")
-		return
-	}
+	user := currentUser(r)
 
-	validToken, err := auth.ValidateAccessJwtToken(headerToken, cfg.jwtSecret)
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
 		return
 	}
 
-	userIDString, err := auth.GetUserID(validToken)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error getting id from token")
+	if params.Handle != "" {
+		err = validateHandle(params.Handle)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		params.Handle = user.Handle
 	}
 
-	userID, err := strconv.Atoi(userIDString)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error parsing id")
-		return
+	// a new email only replaces the current one once confirmed from its inbox
+	pendingEmail := ""
+	if params.Email != "" {
+		email, err := normalizeEmail(params.Email)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !strings.EqualFold(email, user.Email) {
+			owner, err := cfg.DB.GetUserByEmail(email)
+			if err == nil && owner.ID != user.ID {
+				respondWithError(w, http.StatusConflict, "Email is already taken")
+				return
+			}
+			pendingEmail = email
+		}
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
-		return
+	encryptedPassword := user.Password
+	if params.Password != "" {
+		encryptedPassword, err = auth.HashPassword(params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Invalid password")
+			return
+		}
 	}
 
-	encryptedPassword, err := auth.HashPassword(params.Password)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Invalid password")
+	updatedUser, err := cfg.DB.UpdateUser(user.ID, user.Email, encryptedPassword, params.Handle)
+	if errors.Is(err, database.ErrHandleTaken) {
+		respondWithError(w, http.StatusConflict, "Handle is already taken")
 		return
 	}
-
-	updatedUser, err := cfg.DB.UpdateUser(userID, params.Email, string(encryptedPassword))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create user")
 		return
 	}
 
+	if pendingEmail != "" {
+		err = cfg.sendVerificationEmail(updatedUser, pendingEmail)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email")
+			return
+		}
+		cfg.sendMail(mail.Message{
+			To:      updatedUser.Email,
+			Subject: "Your Chirpy email is changing",
+			Body: fmt.Sprintf("Someone asked to change the email of your Chirpy account to %s.\n"+
+				"The change only happens once confirmed from that address. If it wasn't you, reset your password.\n", pendingEmail),
+		})
+	}
+
 	respondWithJSON(w, http.StatusOK, response{
 		User: User{
 			ID:          updatedUser.ID,
 			Email:       updatedUser.Email,
+			Handle:      updatedUser.Handle,
 			IsChirpyRed: updatedUser.IsChirpRed,
+			Role:        string(updatedUser.Role),
+			Verified:    updatedUser.Verified,
 		},
+		PendingEmail: pendingEmail,
 	})
 
 }
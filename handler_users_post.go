@@ -2,21 +2,29 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
 )
 
 type User struct {
 	ID          int    `json:"id"`
 	Email       string `json:"email"`
+	Handle      string `json:"handle,omitempty"`
 	IsChirpyRed bool   `json:"is_chirpy_red"`
+	Role        string `json:"role"`
+	// Verified is set once the user opened the link mailed to the email
+	Verified bool `json:"verified"`
 }
 
 func (cfg *apiConfig) handlerUsersPost(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Handle   string `json:"handle"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -27,21 +35,51 @@ func (cfg *apiConfig) handlerUsersPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	email, err := normalizeEmail(params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if params.Handle != "" {
+		err = validateHandle(params.Handle)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
 	encryptedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Invalid password")
 		return
 	}
 
-	user, err := cfg.DB.CreateUSer(params.Email, string(encryptedPassword))
+	user, err := cfg.DB.CreateUSer(email, string(encryptedPassword), params.Handle)
+	if errors.Is(err, database.ErrUserAlreadyExists) {
+		respondWithError(w, http.StatusConflict, "Email is already taken")
+		return
+	}
+	if errors.Is(err, database.ErrHandleTaken) {
+		respondWithError(w, http.StatusConflict, "Handle is already taken")
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create user")
 		return
 	}
 
+	err = cfg.sendVerificationEmail(user, user.Email)
+	if err != nil {
+		log.Printf("Couldn't send verification email to user %d: %s", user.ID, err)
+	}
+
 	respondWithJSON(w, http.StatusCreated, User{
 		ID:          user.ID,
-		Email:       params.Email,
+		Email:       user.Email,
+		Handle:      user.Handle,
 		IsChirpyRed: user.IsChirpRed,
+		Role:        string(user.Role),
+		Verified:    user.Verified,
 	})
 }
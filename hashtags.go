@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// parseHashtags returns the lowercased #hashtags of a chirp body, without the #, in order of
+// first appearance. A tag is a run of letters, marks, digits and underscores after a # that
+// doesn't follow another word character, and it needs at least one character that isn't a digit.
+func parseHashtags(body string) []string {
+	hashtags := []string{}
+	seen := map[string]bool{}
+
+	prev := ' '
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRuneInString(body[i:])
+		if (r != '#' && r != '＃') || isHashtagRune(prev) || prev == '&' {
+			prev = r
+			i += size
+			continue
+		}
+
+		start := i + size
+		end := start
+		allDigits := true
+		for end < len(body) {
+			r, size := utf8.DecodeRuneInString(body[end:])
+			if !isHashtagRune(r) {
+				break
+			}
+			if !unicode.IsDigit(r) {
+				allDigits = false
+			}
+			end += size
+		}
+
+		tag := strings.ToLower(body[start:end])
+		if end > start && !allDigits && !seen[tag] {
+			seen[tag] = true
+			hashtags = append(hashtags, tag)
+		}
+
+		prev = r
+		i = start
+	}
+
+	return hashtags
+}
+
+// isHashtagRune reports whether r can be part of a hashtag
+func isHashtagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == '_'
+}
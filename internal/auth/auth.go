@@ -1,13 +1,14 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -43,112 +44,33 @@ func GetBearerToken(headers http.Header) (string, error) {
 	return splitAuth[1], nil
 }
 
-// CreateJwtToken creates the jwt token
-func CreateJwtToken(userID int, tokenSecret string, jwtTokenType string) (string, error) {
-	expiresIn, err := GetExpirationTime(jwtTokenType)
+// NewTokenID returns a random jti
+func NewTokenID() (string, error) {
+	ID := make([]byte, 16)
+	_, err := rand.Read(ID)
 	if err != nil {
 		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    fmt.Sprintf("chirpy-%s", jwtTokenType),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject:   fmt.Sprintf("%d", userID),
-	})
-
-	return token.SignedString([]byte(tokenSecret))
-}
-
-// ValidateJwtToken validates token
-func ValidateJwtToken(headerToken string, tokenSecret string) (*jwt.Token, error) {
-	claimStruct := jwt.RegisteredClaims{}
-
-	token, err := jwt.ParseWithClaims(headerToken, &claimStruct, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return token, nil
+	return hex.EncodeToString(ID), nil
 }
 
-// ValidateAccessJwtToken validates if the token is a valid jwt token
-func ValidateAccessJwtToken(headerToken string, tokenSecret string) (*jwt.Token, error) {
-	validToken, err := ValidateJwtToken(headerToken, tokenSecret)
+// NewOneTimeToken returns a random token to send by email,
+// together with the hash to store in its place
+func NewOneTimeToken() (string, string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
 	if err != nil {
-		return nil, err
-	}
-	issuer, err := validToken.Claims.GetIssuer()
-	if err != nil {
-		return nil, err
-	}
-
-	isRefreshToken, err := IsRefreshToken(issuer)
-	if err != nil {
-		return nil, err
-	}
-	if isRefreshToken {
-		return nil, fmt.Errorf("token is not a valid access token")
-	}
-
-	return validToken, nil
-}
-
-// GetUserID returns the userID present in the jwt Token
-func GetUserID(token *jwt.Token) (string, error) {
-	userIDString, err := token.Claims.GetSubject()
-	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return userIDString, nil
+	encoded := base64.RawURLEncoding.EncodeToString(token)
+	return encoded, HashOneTimeToken(encoded), nil
 }
 
-// ValidateRefreshJwtToken validates if the token is a valid jwt token
-func ValidateRefreshJwtToken(headerToken string, tokenSecret string) (*jwt.Token, error) {
-	validToken, err := ValidateJwtToken(headerToken, tokenSecret)
-	if err != nil {
-		return nil, err
-	}
-
-	issuer, err := validToken.Claims.GetIssuer()
-	if err != nil {
-		return nil, err
-	}
-
-	isRefreshToken, err := IsRefreshToken(issuer)
-	if err != nil {
-		return nil, err
-	}
-	if !isRefreshToken {
-		return nil, fmt.Errorf("token is not a valid refresh token")
-	}
-
-	return validToken, nil
-}
-
-// GetExpirationTime returns the jwt token expiration time based on the token type
-func GetExpirationTime(jwtTokenType string) (time.Duration, error) {
-	accessExspiration := 60 * 60           // 1 hour in seconds
-	refreshExpiration := 60 * 60 * 60 * 24 // 60 days in seconds
-	if jwtTokenType == "access" {
-		return time.Duration(accessExspiration) * time.Second, nil
-	} else if jwtTokenType == "refresh" {
-		return time.Duration(refreshExpiration) * time.Second, nil
-	}
-
-	return time.Duration(0), fmt.Errorf("invalid token type: %s", jwtTokenType)
-}
-
-// IsRefreshToken validates if the token is a refresh token
-func IsRefreshToken(issuer string) (bool, error) {
-	if issuer == "chirpy-refresh" {
-		return true, nil
-	} else if issuer == "chirpy-access" {
-		return false, nil
-	}
-
-	return false, fmt.Errorf("not a valid issuer")
+// HashOneTimeToken returns the hash stored for a one-time token.
+// The tokens are random enough that a fast hash can't be brute forced.
+func HashOneTimeToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
 }
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenUse tells access tokens from refresh tokens and two-factor challenges
+type TokenUse string
+
+const (
+	TokenUseAccess  TokenUse = "access"
+	TokenUseRefresh TokenUse = "refresh"
+	// TokenUseTwoFactor is the challenge handed out by a login waiting for the second factor
+	TokenUseTwoFactor TokenUse = "2fa"
+)
+
+// Claims are the claims carried by the tokens of chirpy
+type Claims struct {
+	// UserID is carried in the sub claim
+	UserID   int
+	TokenUse TokenUse
+	// ID is the jti claim, set on refresh tokens
+	ID string
+	// SessionID is the sid claim, set on access tokens
+	SessionID string
+	Roles     []string
+	Scopes    []string
+	Issuer    string
+	Audience  []string
+	IssuedAt  time.Time
+	NotBefore time.Time
+	ExpiresAt time.Time
+}
+
+// HasScope reports whether the token grants the scope
+func (claims Claims) HasScope(scope string) bool {
+	for _, granted := range claims.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tokenClaims is the JSON form of Claims
+type tokenClaims struct {
+	TokenUse  TokenUse `json:"token_use"`
+	SessionID string   `json:"sid,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	// Scope is space separated, as in OAuth
+	Scope string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func newTokenClaims(claims Claims) tokenClaims {
+	return tokenClaims{
+		TokenUse:  claims.TokenUse,
+		SessionID: claims.SessionID,
+		Roles:     claims.Roles,
+		Scope:     strings.Join(claims.Scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    claims.Issuer,
+			Subject:   strconv.Itoa(claims.UserID),
+			Audience:  claims.Audience,
+			ExpiresAt: jwt.NewNumericDate(claims.ExpiresAt),
+			NotBefore: jwt.NewNumericDate(claims.NotBefore),
+			IssuedAt:  jwt.NewNumericDate(claims.IssuedAt),
+			ID:        claims.ID,
+		},
+	}
+}
+
+func (wire tokenClaims) claims() (Claims, error) {
+	userID, err := strconv.Atoi(wire.Subject)
+	if err != nil {
+		return Claims{}, errors.New("invalid user id in token")
+	}
+
+	claims := Claims{
+		UserID:    userID,
+		TokenUse:  wire.TokenUse,
+		ID:        wire.ID,
+		SessionID: wire.SessionID,
+		Roles:     wire.Roles,
+		Scopes:    strings.Fields(wire.Scope),
+		Issuer:    wire.Issuer,
+		Audience:  wire.Audience,
+	}
+	if wire.IssuedAt != nil {
+		claims.IssuedAt = wire.IssuedAt.Time
+	}
+	if wire.NotBefore != nil {
+		claims.NotBefore = wire.NotBefore.Time
+	}
+	if wire.ExpiresAt != nil {
+		claims.ExpiresAt = wire.ExpiresAt.Time
+	}
+
+	return claims, nil
+}
+
+// TokenConfig configures the tokens handed out and accepted
+type TokenConfig struct {
+	Issuer string
+	// AccessAudience is the aud of access tokens, checked by the services accepting them
+	AccessAudience string
+	// RefreshAudience is the aud of refresh tokens, only accepted by chirpy itself
+	RefreshAudience string
+	// TwoFactorAudience is the aud of two-factor challenges, only accepted by chirpy itself
+	TwoFactorAudience string
+	AccessLifetime    time.Duration
+	RefreshLifetime   time.Duration
+	// TwoFactorLifetime is how long a login waits for the second factor
+	TwoFactorLifetime time.Duration
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat
+	Leeway time.Duration
+}
+
+// DefaultTokenConfig returns the token settings used unless configured otherwise
+func DefaultTokenConfig() TokenConfig {
+	return TokenConfig{
+		Issuer:            "chirpy",
+		AccessAudience:    "chirpy-api",
+		RefreshAudience:   "chirpy-refresh",
+		TwoFactorAudience: "chirpy-2fa",
+		AccessLifetime:    time.Hour,
+		RefreshLifetime:   60 * 24 * time.Hour,
+		TwoFactorLifetime: 5 * time.Minute,
+		Leeway:            30 * time.Second,
+	}
+}
+
+// TokenIssuer signs and validates tokens with the keys of a keyring
+type TokenIssuer struct {
+	keyring *Keyring
+	config  TokenConfig
+}
+
+// NewTokenIssuer returns an issuer of tokens signed by the keyring
+func NewTokenIssuer(keyring *Keyring, config TokenConfig) *TokenIssuer {
+	return &TokenIssuer{
+		keyring: keyring,
+		config:  config,
+	}
+}
+
+// Lifetime returns how long the tokens of the use are valid
+func (issuer *TokenIssuer) Lifetime(use TokenUse) time.Duration {
+	switch use {
+	case TokenUseRefresh:
+		return issuer.config.RefreshLifetime
+	case TokenUseTwoFactor:
+		return issuer.config.TwoFactorLifetime
+	}
+	return issuer.config.AccessLifetime
+}
+
+// audience returns the aud of the tokens of the use
+func (issuer *TokenIssuer) audience(use TokenUse) (string, error) {
+	switch use {
+	case TokenUseAccess:
+		return issuer.config.AccessAudience, nil
+	case TokenUseRefresh:
+		return issuer.config.RefreshAudience, nil
+	case TokenUseTwoFactor:
+		return issuer.config.TwoFactorAudience, nil
+	}
+
+	return "", fmt.Errorf("invalid token use: %s", use)
+}
+
+// Issue signs a token with the claims. The issuer, audience and times are filled in
+// from the token use, and the claims are returned as signed.
+func (issuer *TokenIssuer) Issue(claims Claims) (string, Claims, error) {
+	audience, err := issuer.audience(claims.TokenUse)
+	if err != nil {
+		return "", Claims{}, err
+	}
+
+	now := time.Now().UTC()
+	claims.Issuer = issuer.config.Issuer
+	claims.Audience = []string{audience}
+	claims.IssuedAt = now
+	claims.NotBefore = now
+	claims.ExpiresAt = now.Add(issuer.Lifetime(claims.TokenUse))
+
+	signedToken, err := issuer.keyring.sign(newTokenClaims(claims))
+	if err != nil {
+		return "", Claims{}, err
+	}
+
+	return signedToken, claims, nil
+}
+
+// Validate checks the signature, issuer, audience and times of the token
+// and that it was issued for the use, then returns its claims
+func (issuer *TokenIssuer) Validate(headerToken string, use TokenUse) (Claims, error) {
+	audience, err := issuer.audience(use)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	wire := tokenClaims{}
+	_, err = jwt.ParseWithClaims(headerToken, &wire, issuer.keyring.keyFunc,
+		jwt.WithIssuer(issuer.config.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithLeeway(issuer.config.Leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return Claims{}, err
+	}
+	if wire.TokenUse != use {
+		return Claims{}, fmt.Errorf("token is not a valid %s token", use)
+	}
+
+	return wire.claims()
+}
+
+// JWKS returns the public keys verifying the tokens of the issuer
+func (issuer *TokenIssuer) JWKS() JWKS {
+	return issuer.keyring.JWKS()
+}
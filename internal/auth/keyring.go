@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted in the keyring
+const minRSAKeyBits = 2048
+
+// key signs or verifies the tokens carrying its ID in the kid header
+type key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// private is nil for keys only kept to verify the tokens signed before a rotation
+	private crypto.Signer
+	public  crypto.PublicKey
+	// secret is the shared HS256 secret, it is never published
+	secret []byte
+}
+
+// signingKey returns the key handed to the signing method
+func (k *key) signingKey() interface{} {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.private
+}
+
+// verificationKey returns the key handed to the signing method to verify a token
+func (k *key) verificationKey() interface{} {
+	if k.secret != nil {
+		return k.secret
+	}
+	return k.public
+}
+
+// Keyring holds the key tokens are signed with and every key they are verified with.
+// Keeping the previous keys after a rotation lets the tokens they signed live out their lifetime.
+type Keyring struct {
+	signing *key
+	keys    map[string]*key
+}
+
+// NewKeyring returns an empty keyring
+func NewKeyring() *Keyring {
+	return &Keyring{
+		keys: map[string]*key{},
+	}
+}
+
+// AddSecret adds the shared HS256 secret, used for the tokens without a kid header.
+// It signs the new tokens while the keyring has no other signing key.
+func (keyring *Keyring) AddSecret(secret string) {
+	keyring.keys[""] = &key{
+		Method: jwt.SigningMethodHS256,
+		secret: []byte(secret),
+	}
+	if keyring.signing == nil {
+		keyring.signing = keyring.keys[""]
+	}
+}
+
+// AddPEM adds the Ed25519 or RSA key in the PEM data under the kid.
+// A PKCS #8 private key can sign tokens, a PKIX public key only verifies them.
+func (keyring *Keyring) AddPEM(kid string, data []byte) error {
+	if kid == "" {
+		return errors.New("key id is empty")
+	}
+	if _, ok := keyring.keys[kid]; ok {
+		return fmt.Errorf("duplicated key id: %s", kid)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("key %s: no PEM data found", kid)
+	}
+
+	k := &key{ID: kid}
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", kid, err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("key %s: unsupported private key type %T", kid, private)
+		}
+		k.private = signer
+		k.public = signer.Public()
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", kid, err)
+		}
+		k.public = public
+	default:
+		return fmt.Errorf("key %s: unsupported PEM block %q", kid, block.Type)
+	}
+
+	switch public := k.public.(type) {
+	case ed25519.PublicKey:
+		k.Method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSAKeyBits {
+			return fmt.Errorf("key %s: RSA keys need at least %d bits", kid, minRSAKeyBits)
+		}
+		k.Method = jwt.SigningMethodRS256
+	default:
+		return fmt.Errorf("key %s: unsupported key type %T, use Ed25519 or RSA", kid, public)
+	}
+
+	keyring.keys[kid] = k
+	return nil
+}
+
+// SetSigningKey picks the key new tokens are signed with
+func (keyring *Keyring) SetSigningKey(kid string) error {
+	k, ok := keyring.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown signing key: %s", kid)
+	}
+	if k.private == nil && k.secret == nil {
+		return fmt.Errorf("key %s has no private key to sign with", kid)
+	}
+
+	keyring.signing = k
+	return nil
+}
+
+// LoadKeyring builds the keyring from the <kid>.pem files of the directory
+// and the shared secret, either of which may be empty.
+// Without a signing kid, the only private key of the directory signs the tokens.
+func LoadKeyring(dir, signingKID, secret string) (*Keyring, error) {
+	keyring := NewKeyring()
+	privateKIDs := []string{}
+
+	if dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			dat, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+			err = keyring.AddPEM(kid, dat)
+			if err != nil {
+				return nil, err
+			}
+			if keyring.keys[kid].private != nil {
+				privateKIDs = append(privateKIDs, kid)
+			}
+		}
+	}
+
+	if signingKID == "" && len(privateKIDs) > 1 {
+		return nil, fmt.Errorf("%d private keys found in %s, pick the signing key", len(privateKIDs), dir)
+	}
+	if signingKID == "" && len(privateKIDs) == 1 {
+		signingKID = privateKIDs[0]
+	}
+	if signingKID != "" {
+		err := keyring.SetSigningKey(signingKID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if secret != "" {
+		keyring.AddSecret(secret)
+	}
+	if keyring.signing == nil {
+		return nil, errors.New("no key to sign tokens with, set JWT_SECRET or add a private key")
+	}
+
+	return keyring, nil
+}
+
+// GenerateKey returns a new private key for the signing method ("EdDSA" or "RS256"),
+// encoded as a PKCS #8 PEM block
+func GenerateKey(alg string) ([]byte, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	default:
+		return nil, fmt.Errorf("unsupported signing method: %s", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dat, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: dat}), nil
+}
+
+// sign signs the claims with the signing key and names it in the kid header
+func (keyring *Keyring) sign(claims jwt.Claims) (string, error) {
+	k := keyring.signing
+	if k == nil {
+		return "", errors.New("keyring has no signing key")
+	}
+
+	token := jwt.NewWithClaims(k.Method, claims)
+	if k.ID != "" {
+		token.Header["kid"] = k.ID
+	}
+
+	return token.SignedString(k.signingKey())
+}
+
+// keyFunc returns the key named by the kid header of the token.
+// The algorithm of the token must be the one of the key, so that a public key
+// can't be passed off as an HS256 secret.
+func (keyring *Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid := ""
+	if rawKID, ok := token.Header["kid"]; ok {
+		kid, ok = rawKID.(string)
+		if !ok {
+			return nil, errors.New("kid header is not a string")
+		}
+	}
+
+	k, ok := keyring.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key: %q", kid)
+	}
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("key %q doesn't sign with %s", kid, token.Method.Alg())
+	}
+
+	return k.verificationKey(), nil
+}
+
+// JWK is a public key of the keyring in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	// Curve and X describe Ed25519 keys (RFC 8037)
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	// N and E describe RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+// JWKS is the set of public keys verifying the tokens of the keyring
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the keyring, sorted by kid.
+// The shared secret is left out, tokens signed with it can't be verified by others.
+func (keyring *Keyring) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range keyring.keys {
+		if k.secret != nil {
+			continue
+		}
+
+		jwk := JWK{
+			KeyID:     k.ID,
+			Algorithm: k.Method.Alg(),
+			Use:       "sig",
+		}
+		switch public := k.public.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+
+	return set
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The TOTP settings understood by every authenticator app: SHA-1, six digits and 30 second steps
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+	// totpSecretBytes is the 160 bit secret recommended by RFC 4226
+	totpSecretBytes = 20
+	// recoveryCodeGroups of recoveryCodeGroupLength characters, 80 bits in all
+	recoveryCodeGroups      = 4
+	recoveryCodeGroupLength = 4
+)
+
+var ErrInvalidTOTPCode = errors.New("invalid two-factor code")
+
+// totpEncoding is the unpadded base32 of the secrets shown to users
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random secret, base32 encoded as authenticator apps expect it
+func NewTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretBytes)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPProvisioningURI returns the otpauth URI authenticator apps enroll from
+func TOTPProvisioningURI(secret, issuer, account string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTPDigits))
+	query.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+
+	return "otpauth://totp/" + escapeLabel(issuer) + ":" + escapeLabel(account) + "?" + query.Encode()
+}
+
+// escapeLabel percent-encodes a part of the label, spaces included, as apps don't agree on "+"
+func escapeLabel(part string) string {
+	return strings.ReplaceAll(url.QueryEscape(part), "+", "%20")
+}
+
+// TOTPStep returns the time step of the time
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// TOTPCode returns the code of the secret for the time step (RFC 4226 and RFC 6238)
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", TOTPDigits, value%modulo), nil
+}
+
+// ValidateTOTP looks for the code among the time steps within drift steps of now
+// that are later than lastStep, and returns the step it matched.
+// Refusing lastStep and the steps before it keeps an accepted code from being replayed.
+func ValidateTOTP(secret, code string, now time.Time, drift int, lastStep int64) (int64, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, ErrInvalidTOTPCode
+	}
+
+	current := TOTPStep(now)
+	for step := current - int64(drift); step <= current+int64(drift); step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+
+	return 0, ErrInvalidTOTPCode
+}
+
+// NewRecoveryCodes returns count random single-use recovery codes, formatted as
+// "xxxx-xxxx-xxxx-xxxx", and their hashes to store
+func NewRecoveryCodes(count int) ([]string, []string, error) {
+	// 32 characters, so that each random byte picks one without bias
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+	codes := make([]string, 0, count)
+	hashes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		random := make([]byte, recoveryCodeGroups*recoveryCodeGroupLength)
+		_, err := rand.Read(random)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.Builder{}
+		for j, b := range random {
+			if j > 0 && j%recoveryCodeGroupLength == 0 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(alphabet[b&31])
+		}
+		codes = append(codes, code.String())
+		hashes = append(hashes, HashRecoveryCode(code.String()))
+	}
+
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hash stored for a recovery code,
+// ignoring case, spaces and dashes as typed by the user
+func HashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+
+	return HashOneTimeToken(normalized)
+}
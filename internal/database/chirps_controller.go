@@ -2,6 +2,9 @@ package database
 
 import (
 	"errors"
+	"slices"
+	"sort"
+	"time"
 )
 
 var ErrNotExist = errors.New("resource does not exist")
@@ -10,26 +13,229 @@ type Chirp struct {
 	ID       int
 	Body     string
 	AuthorID int
+	// InReplyTo is the ID of the parent chirp, zero when the chirp is not a reply
+	InReplyTo int
+	// Deleted marks a tombstone: a deleted chirp kept, without its body,
+	// so that the replies below it still form a thread
+	Deleted bool
+	// LikeCount is the number of likes, kept up to date by LikeChirp and UnlikeChirp
+	LikeCount int
+	// RechirpOf is the ID of the reshared chirp, zero when the chirp is not a reshare.
+	// A rechirp has no body of its own, a quote-chirp does.
+	RechirpOf int
+	// RechirpCount and QuoteCount are the numbers of live rechirps and quote-chirps of the chirp
+	RechirpCount int
+	QuoteCount   int
+	// Hashtags are the lowercased tags found in the body, without the leading #
+	Hashtags []string
+	// Mentions are the @handles of the body resolved to users
+	Mentions []Mention
+	// Flagged marks chirps matching a moderation rule that asks for review
+	Flagged bool
+	// Hidden marks a chirp hidden by a moderator: it stays in its thread
+	// but is left out of listings, search and likes until shown again
+	Hidden    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
-// CreateChirp creates a new chirp and saves it to disk
-func (db *DB) CreateChirp(body string, authorID int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return Chirp{}, err
+// Mention is an @handle of a chirp body resolved to a user.
+// Start and End are the offsets of the mention in characters of the body, End excluded.
+type Mention struct {
+	UserID int
+	Start  int
+	End    int
+}
+
+// MentionedUserIDs returns the IDs of the users mentioned by the chirp, once each
+func (chirp Chirp) MentionedUserIDs() []int {
+	userIDs := []int{}
+	for _, mention := range chirp.Mentions {
+		if !slices.Contains(userIDs, mention.UserID) {
+			userIDs = append(userIDs, mention.UserID)
+		}
 	}
 
-	lenChirps := len(dbStructure.Chirps)
-	ID := dbStructure.Chirps[lenChirps-1].ID + 1
-	chirp := Chirp{
-		ID:       ID,
-		Body:     body,
-		AuthorID: authorID,
+	return userIDs
+}
+
+// IsRechirp reports whether the chirp is a plain rechirp, a reshare without a body of its own
+func (chirp Chirp) IsRechirp() bool {
+	return chirp.RechirpOf != 0 && chirp.Body == ""
+}
+
+// CreateChirpParams holds the values of a new chirp
+type CreateChirpParams struct {
+	Body      string
+	AuthorID  int
+	InReplyTo int
+	// RechirpOf reshares a chirp, as a rechirp when Body is empty or as a quote-chirp otherwise
+	RechirpOf int
+	Hashtags  []string
+	Mentions  []Mention
+	Flagged   bool
+}
+
+// ThreadQuery selects a page of the descendants of a chirp, in depth-first order
+type ThreadQuery struct {
+	// After is the path of the last chirp of the previous page
+	After []int
+	// Limit is the maximum number of chirps returned, zero for no limit
+	Limit int
+}
+
+// ThreadChirp is a chirp in the descendant tree of another chirp
+type ThreadChirp struct {
+	Chirp
+	// Path holds the IDs from the root's direct reply down to this chirp
+	Path []int
+}
+
+// ChirpSort is the order of a page of chirps
+type ChirpSort int
+
+const (
+	ChirpSortID ChirpSort = iota
+	ChirpSortCreated
+	ChirpSortUpdated
+	ChirpSortLikes
+)
+
+// ChirpCursor is the position of a chirp in one of the sort orders.
+// It marks the last chirp of a page.
+type ChirpCursor struct {
+	Count int       `json:"count,omitempty"`
+	Time  time.Time `json:"time"`
+	ID    int       `json:"id"`
+}
+
+// ChirpQuery selects a page of chirps
+type ChirpQuery struct {
+	// AuthorID restricts the page to one author when not zero
+	AuthorID int
+	// TimelineOf restricts the page, when not zero, to the chirps of this user
+	// and of the users they follow
+	TimelineOf int
+	// Hashtag restricts the page to the chirps tagged with it when not empty
+	Hashtag string
+	// MentionOf restricts the page to the chirps mentioning this user when not zero
+	MentionOf  int
+	SortBy     ChirpSort
+	Descending bool
+	// Since and Until bound the creation time when not zero
+	Since time.Time
+	Until time.Time
+	// After continues from the chirp following the cursor
+	After *ChirpCursor
+	// Limit is the maximum number of chirps returned, zero for no limit
+	Limit int
+}
+
+func (c ChirpCursor) less(other ChirpCursor) bool {
+	if c.Count != other.Count {
+		return c.Count < other.Count
+	}
+	if !c.Time.Equal(other.Time) {
+		return c.Time.Before(other.Time)
+	}
+	return c.ID < other.ID
+}
+
+// Cursor returns the position of the chirp in the given order
+func (chirp Chirp) Cursor(sortBy ChirpSort) ChirpCursor {
+	switch sortBy {
+	case ChirpSortCreated:
+		return ChirpCursor{Time: chirp.CreatedAt, ID: chirp.ID}
+	case ChirpSortUpdated:
+		return ChirpCursor{Time: chirp.UpdatedAt, ID: chirp.ID}
+	case ChirpSortLikes:
+		return ChirpCursor{Count: chirp.LikeCount, ID: chirp.ID}
+	}
+	return ChirpCursor{ID: chirp.ID}
+}
+
+// matches reports whether the chirp passes the query filters
+func (query ChirpQuery) matches(chirp Chirp) bool {
+	if chirp.Deleted || chirp.Hidden {
+		return false
+	}
+	if query.AuthorID != 0 && chirp.AuthorID != query.AuthorID {
+		return false
+	}
+	if query.Hashtag != "" && !slices.Contains(chirp.Hashtags, query.Hashtag) {
+		return false
 	}
+	if query.MentionOf != 0 && !slices.Contains(chirp.MentionedUserIDs(), query.MentionOf) {
+		return false
+	}
+	if !query.Since.IsZero() && chirp.CreatedAt.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && chirp.CreatedAt.After(query.Until) {
+		return false
+	}
+	return true
+}
 
-	dbStructure.Chirps[lenChirps] = chirp
+// CreateChirp creates a new chirp and saves it to disk.
+// A reply to, or a reshare of, a chirp that doesn't exist, was deleted or is hidden returns ErrNotExist.
+// Rechirping a rechirp reshares its original, and rechirping a chirp twice
+// returns the existing rechirp.
+func (db *DB) CreateChirp(params CreateChirpParams) (Chirp, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
 
-	err = db.writeDB(dbStructure)
+	if params.InReplyTo != 0 {
+		parent, ok := db.data.Chirps[params.InReplyTo]
+		if !ok || parent.Deleted || parent.Hidden {
+			return Chirp{}, ErrNotExist
+		}
+	}
+
+	ops := []walOp{}
+	if params.RechirpOf != 0 {
+		original, ok := db.data.Chirps[params.RechirpOf]
+		if !ok || original.Deleted || original.Hidden {
+			return Chirp{}, ErrNotExist
+		}
+		if params.Body == "" && original.IsRechirp() {
+			original, ok = db.data.Chirps[original.RechirpOf]
+			if !ok || original.Deleted || original.Hidden {
+				return Chirp{}, ErrNotExist
+			}
+		}
+		params.RechirpOf = original.ID
+
+		if params.Body == "" {
+			for _, ID := range db.chirpsByAuthor[params.AuthorID] {
+				chirp := db.data.Chirps[ID]
+				if chirp.IsRechirp() && chirp.RechirpOf == original.ID && !chirp.Deleted {
+					return chirp, nil
+				}
+			}
+			original.RechirpCount++
+		} else {
+			original.QuoteCount++
+		}
+		ops = append(ops, putOp("chirps", original.ID, original))
+	}
+
+	now := time.Now().UTC()
+	ID, sequenceOp := db.nextID("chirps")
+	chirp := Chirp{
+		ID:        ID,
+		Body:      params.Body,
+		AuthorID:  params.AuthorID,
+		InReplyTo: params.InReplyTo,
+		RechirpOf: params.RechirpOf,
+		Hashtags:  params.Hashtags,
+		Mentions:  params.Mentions,
+		Flagged:   params.Flagged,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err := db.commit(append(ops, sequenceOp, putOp("chirps", ID, chirp))...)
 	if err != nil {
 		return Chirp{}, err
 	}
@@ -39,13 +245,11 @@ func (db *DB) CreateChirp(body string, authorID int) (Chirp, error) {
 
 // GetChirps returns all chirps in the database
 func (db *DB) GetChirps() ([]Chirp, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return nil, err
-	}
+	db.mux.RLock()
+	defer db.mux.RUnlock()
 
-	chirps := make([]Chirp, 0, len(dbStructure.Chirps))
-	for _, chirp := range dbStructure.Chirps {
+	chirps := make([]Chirp, 0, len(db.data.Chirps))
+	for _, chirp := range db.data.Chirps {
 		chirps = append(chirps, chirp)
 	}
 
@@ -54,12 +258,10 @@ func (db *DB) GetChirps() ([]Chirp, error) {
 
 // GetChirpsById returns the chirp with the correspondent ID
 func (db *DB) GetChirpsById(id int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return Chirp{}, err
-	}
+	db.mux.RLock()
+	defer db.mux.RUnlock()
 
-	chirp, ok := dbStructure.Chirps[id]
+	chirp, ok := db.data.Chirps[id]
 	if !ok {
 		return Chirp{}, ErrNotExist
 	}
@@ -69,35 +271,278 @@ func (db *DB) GetChirpsById(id int) (Chirp, error) {
 
 // GetChirpsByAuthorId returns the chirp with the correspondent AuthorID
 func (db *DB) GetChirpsByAuthorId(authorID int) ([]Chirp, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return []Chirp{}, err
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	keys := db.chirpsByAuthor[authorID]
+	chirps := make([]Chirp, 0, len(keys))
+	for _, key := range keys {
+		chirps = append(chirps, db.data.Chirps[key])
+	}
+
+	return chirps, nil
+}
+
+// GetChirpsPage returns the page of chirps selected by the query.
+// The chirps are walked in the order of the matching sorted index,
+// starting at the cursor, until the page is full.
+func (db *DB) GetChirpsPage(query ChirpQuery) ([]Chirp, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	if query.TimelineOf != 0 {
+		authors := append([]int{query.TimelineOf}, db.following[query.TimelineOf]...)
+		if query.SortBy == ChirpSortID {
+			return db.pageChirps(db.mergeAuthorChirps(authors, query), query, nil), nil
+		}
+
+		inTimeline := map[int]bool{}
+		for _, authorID := range authors {
+			inTimeline[authorID] = true
+		}
+		return db.pageChirps(db.chirpOrders[query.SortBy], query, func(chirp Chirp) bool {
+			return inTimeline[chirp.AuthorID]
+		}), nil
 	}
 
-	chirps := make([]Chirp, 0, len(dbStructure.Chirps))
-	for _, chirp := range dbStructure.Chirps {
-		if chirp.AuthorID == authorID {
+	IDs := db.chirpOrders[query.SortBy]
+	if query.SortBy == ChirpSortID && query.AuthorID != 0 {
+		IDs = db.chirpsByAuthor[query.AuthorID]
+	} else if query.SortBy == ChirpSortID && query.Hashtag != "" {
+		IDs = db.chirpsByTag[query.Hashtag]
+	} else if query.SortBy == ChirpSortID && query.MentionOf != 0 {
+		IDs = db.chirpsMentioning[query.MentionOf]
+	}
+
+	return db.pageChirps(IDs, query, nil), nil
+}
+
+// mergeAuthorChirps returns, in ascending order, the chirp IDs of the authors
+// that can appear in a page sorted by ID. Each author contributes at most
+// a page worth of chirps after the cursor, unless the time filters may skip some.
+// Callers must hold the lock.
+func (db *DB) mergeAuthorChirps(authors []int, query ChirpQuery) []int {
+	limit := query.Limit
+	if !query.Since.IsZero() || !query.Until.IsZero() {
+		limit = 0
+	}
+
+	merged := []int{}
+	for _, authorID := range authors {
+		IDs := db.chirpsByAuthor[authorID]
+
+		start, end := 0, len(IDs)
+		if query.Descending {
+			if query.After != nil {
+				end = sort.SearchInts(IDs, query.After.ID)
+			}
+			if limit > 0 {
+				start = max(0, end-limit)
+			}
+		} else {
+			if query.After != nil {
+				start = sort.SearchInts(IDs, query.After.ID+1)
+			}
+			if limit > 0 {
+				end = min(end, start+limit)
+			}
+		}
+		merged = append(merged, IDs[start:end]...)
+	}
+	sort.Ints(merged)
+
+	return merged
+}
+
+// pageChirps walks IDs, sorted in the query order, from the query cursor
+// and collects the chirps passing the query and the optional extra filter.
+// Callers must hold the lock.
+func (db *DB) pageChirps(IDs []int, query ChirpQuery, filter func(Chirp) bool) []Chirp {
+	keyAt := func(i int) ChirpCursor {
+		return db.data.Chirps[IDs[i]].Cursor(query.SortBy)
+	}
+
+	chirps := []Chirp{}
+	collect := func(i int) bool {
+		chirp := db.data.Chirps[IDs[i]]
+		if query.matches(chirp) && (filter == nil || filter(chirp)) {
 			chirps = append(chirps, chirp)
 		}
+		return query.Limit == 0 || len(chirps) < query.Limit
 	}
 
-	return chirps, nil
+	if query.Descending {
+		end := len(IDs)
+		if query.After != nil {
+			end = sort.Search(len(IDs), func(i int) bool { return !keyAt(i).less(*query.After) })
+		}
+		for i := end - 1; i >= 0; i-- {
+			if !collect(i) {
+				break
+			}
+		}
+		return chirps
+	}
+
+	start := 0
+	if query.After != nil {
+		start = sort.Search(len(IDs), func(i int) bool { return query.After.less(keyAt(i)) })
+	}
+	for i := start; i < len(IDs); i++ {
+		if !collect(i) {
+			break
+		}
+	}
+	return chirps
+}
+
+// GetChirpAncestors returns the chain of chirps the chirp replies to, root first
+func (db *DB) GetChirpAncestors(id int) ([]Chirp, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	chirp, ok := db.data.Chirps[id]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	ancestors := []Chirp{}
+	for chirp.InReplyTo != 0 {
+		chirp, ok = db.data.Chirps[chirp.InReplyTo]
+		if !ok {
+			break
+		}
+		ancestors = append([]Chirp{chirp}, ancestors...)
+	}
+
+	return ancestors, nil
 }
 
-// DeleteChirp deletes the chirp
+// GetChirpDescendants returns a page of the replies below the chirp, in depth-first order.
+// The traversal resumes right after the path of the query, so no earlier reply is visited.
+func (db *DB) GetChirpDescendants(id int, query ThreadQuery) ([]ThreadChirp, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	if _, ok := db.data.Chirps[id]; !ok {
+		return nil, ErrNotExist
+	}
+
+	// each frame is a list of siblings and the index of the next one to visit,
+	// frame k holds the replies to path[k-1] (to the root for k = 0)
+	type frame struct {
+		IDs  []int
+		next int
+	}
+	stack := []frame{}
+	path := []int{}
+
+	parent := id
+	for _, pathID := range query.After {
+		siblings := db.repliesTo[parent]
+		stack = append(stack, frame{
+			IDs:  siblings,
+			next: sort.SearchInts(siblings, pathID+1),
+		})
+		path = append(path, pathID)
+		parent = pathID
+	}
+	stack = append(stack, frame{IDs: db.repliesTo[parent]})
+
+	descendants := []ThreadChirp{}
+	for len(stack) > 0 && (query.Limit == 0 || len(descendants) < query.Limit) {
+		top := &stack[len(stack)-1]
+		if top.next >= len(top.IDs) {
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 {
+				path = path[:len(stack)-1]
+			}
+			continue
+		}
+
+		replyID := top.IDs[top.next]
+		top.next++
+
+		path = append(path[:len(stack)-1], replyID)
+		descendants = append(descendants, ThreadChirp{
+			Chirp: db.data.Chirps[replyID],
+			Path:  append([]int{}, path...),
+		})
+		stack = append(stack, frame{IDs: db.repliesTo[replyID]})
+	}
+
+	return descendants, nil
+}
+
+// DeleteChirp deletes the chirp.
+// A chirp with replies becomes a tombstone instead, and tombstones
+// left without replies are removed along with their last reply.
 func (db *DB) DeleteChirp(chirp Chirp) error {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	chirp, ok := db.data.Chirps[chirp.ID]
+	if !ok {
+		return ErrNotExist
+	}
+
+	ops := db.unshareOps(chirp)
+	if len(db.repliesTo[chirp.ID]) > 0 {
+		chirp.Deleted = true
+		chirp.Body = ""
+		chirp.Hashtags = nil
+		chirp.Mentions = nil
+		chirp.UpdatedAt = time.Now().UTC()
+		return db.commit(append(ops, putOp("chirps", chirp.ID, chirp))...)
 	}
 
-	// delete(map, key)
-	delete(dbStructure.Chirps, chirp.ID)
+	ops = append(ops, db.deleteChirpOps(chirp.ID)...)
+	for chirp.InReplyTo != 0 {
+		parent, ok := db.data.Chirps[chirp.InReplyTo]
+		if !ok || !parent.Deleted || len(db.repliesTo[parent.ID]) > 1 {
+			break
+		}
+		ops = append(ops, db.deleteChirpOps(parent.ID)...)
+		chirp = parent
+	}
+
+	return db.commit(ops...)
+}
+
+// SetChirpHidden hides the chirp, or shows it again.
+// Chirps that don't exist or were deleted return ErrNotExist.
+func (db *DB) SetChirpHidden(id int, hidden bool) (Chirp, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	chirp, ok := db.data.Chirps[id]
+	if !ok || chirp.Deleted {
+		return Chirp{}, ErrNotExist
+	}
 
-	err = db.writeDB(dbStructure)
+	chirp.Hidden = hidden
+	err := db.commit(putOp("chirps", id, chirp))
 	if err != nil {
-		return err
+		return Chirp{}, err
+	}
+
+	return chirp, nil
+}
+
+// unshareOps returns the operations removing a reshare being deleted from the counts of its original.
+// Tombstones were already removed from the counts.
+// Callers must hold the write lock.
+func (db *DB) unshareOps(chirp Chirp) []walOp {
+	original, ok := db.data.Chirps[chirp.RechirpOf]
+	if chirp.RechirpOf == 0 || chirp.Deleted || !ok {
+		return nil
+	}
+
+	if chirp.IsRechirp() {
+		original.RechirpCount--
+	} else {
+		original.QuoteCount--
 	}
 
-	return nil
+	return []walOp{putOp("chirps", original.ID, original)}
 }
@@ -3,30 +3,125 @@ package database
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 )
 
 type DB struct {
-	path string
-	mux  *sync.RWMutex
+	path             string
+	walPath          string
+	walEntries       int
+	compactThreshold int
+	mux              *sync.RWMutex
+	snowflake        *snowflake
+
+	// data is the whole database, kept in memory and guarded by mux
+	data DBStructure
+	// usersByEmail maps lowercased emails to user keys
+	usersByEmail map[string]int
+	// usersByHandle maps lowercased handles to user keys
+	usersByHandle map[string]int
+	// chirpOrders holds every chirp ID for each sort order, ascending
+	chirpOrders map[ChirpSort][]int
+	// chirpsByAuthor maps author IDs to their chirp IDs in ascending order
+	chirpsByAuthor map[int][]int
+	// repliesTo maps chirp IDs to the sorted IDs of their direct replies
+	repliesTo map[int][]int
+	// chirpsMentioning maps user IDs to the sorted IDs of the chirps mentioning them
+	chirpsMentioning map[int][]int
+	// chirpsByTag maps hashtags to the sorted IDs of the chirps using them
+	chirpsByTag map[string][]int
+	// searchPostings maps terms to the chirps containing them and their positions in each chirp
+	searchPostings map[string]map[int][]int
+	// searchLengths maps the indexed chirp IDs to their length in terms
+	searchLengths     map[int]int
+	searchTotalLength int
+	// likesByChirp maps chirp IDs to the sorted IDs of the users liking them
+	likesByChirp map[int][]int
+	// reportsByStatus maps report statuses to the sorted IDs of the reports in them
+	reportsByStatus map[ReportStatus][]int
+	// actionsByReport maps report IDs to the sorted IDs of their log entries
+	actionsByReport map[int][]int
+	// refreshTokenFamilies maps refresh token family IDs to the jtis of their tokens
+	refreshTokenFamilies map[string][]string
+	// sessionsByUser maps user IDs to the IDs of their sessions
+	sessionsByUser map[int][]string
+	// following maps user IDs to the sorted IDs of the users they follow
+	following map[int][]int
+	// followers maps user IDs to the sorted IDs of their followers
+	followers map[int][]int
 }
 
 type DBStructure struct {
-	Chirps        map[int]Chirp           `json:"chirps"`
-	Users         map[int]User            `json:"users"`
-	RevokedTokens map[string]RevokedToken `json:"revoked_tokens"`
+	SchemaVersion int           `json:"schema_version"`
+	Chirps        map[int]Chirp `json:"chirps"`
+	Users         map[int]User  `json:"users"`
+	// RefreshTokens is keyed by jti
+	RefreshTokens map[string]RefreshToken `json:"refresh_tokens"`
+	// Sessions is keyed by the family ID of their refresh tokens
+	Sessions map[string]Session `json:"sessions"`
+	// PasswordResets is keyed by the hash of their token
+	PasswordResets map[string]PasswordReset `json:"password_resets"`
+	// EmailVerifications is keyed by the hash of their token
+	EmailVerifications map[string]EmailVerification `json:"email_verifications"`
+	// TOTP is keyed by user ID
+	TOTP map[int]TOTP `json:"totp"`
+	// Sequences holds the last ID allocated for each entity
+	Sequences map[string]int `json:"sequences"`
+	// Follows is keyed by "followerID:followeeID"
+	Follows map[string]Follow `json:"follows"`
+	// Likes is keyed by "userID:chirpID"
+	Likes   map[string]Like `json:"likes"`
+	Reports map[int]Report  `json:"reports"`
+	// ReportActions is the moderation log of every report
+	ReportActions map[int]ReportAction `json:"report_actions"`
 }
 
 // NewDB creates a new database connection
-// and creates the database file if it doesn't exist
-func NewDB(path string) (*DB, error) {
+// and creates the database file if it doesn't exist.
+// Files written with an older schema are migrated to the current version,
+// then pending write-ahead log entries are replayed and folded into the file.
+// The database is then served from memory; disk is only written on mutation.
+func NewDB(path string, opts Options) (*DB, error) {
+	generator, err := newIDGenerator(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	db := &DB{
-		path: path,
-		mux:  &sync.RWMutex{},
+		path:             path,
+		walPath:          path + ".wal",
+		compactThreshold: defaultCompactThreshold,
+		mux:              &sync.RWMutex{},
+		snowflake:        generator,
+	}
+	err = db.ensureDB()
+	if err != nil {
+		return db, err
+	}
+
+	_, err = db.migrate(false)
+	if err != nil {
+		return db, err
 	}
-	err := db.ensureDB()
-	return db, err
+
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	db.data, err = db.loadDB()
+	if err != nil {
+		return db, err
+	}
+	db.rebuildIndexes()
+
+	err = db.replayWAL()
+	if err != nil {
+		return db, err
+	}
+
+	return db, db.compact()
 }
 
 // ensureDB creates a new database file if it doesn't exist
@@ -43,37 +138,81 @@ func (db *DB) ensureDB() error {
 // ensureDB creates a new database file if it doesn't exist
 func (db *DB) createDB() error {
 	dbStructure := DBStructure{
-		Chirps:        map[int]Chirp{},
-		Users:         map[int]User{},
-		RevokedTokens: map[string]RevokedToken{},
+		SchemaVersion:      currentSchemaVersion,
+		Chirps:             map[int]Chirp{},
+		Users:              map[int]User{},
+		RefreshTokens:      map[string]RefreshToken{},
+		Sessions:           map[string]Session{},
+		PasswordResets:     map[string]PasswordReset{},
+		EmailVerifications: map[string]EmailVerification{},
+		TOTP:               map[int]TOTP{},
+		Sequences:          map[string]int{},
+		Follows:            map[string]Follow{},
+		Likes:              map[string]Like{},
+		Reports:            map[int]Report{},
+		ReportActions:      map[int]ReportAction{},
 	}
 
 	return db.writeDB(dbStructure)
 }
 
-// writeDB writes the database file to disk
+// writeDB atomically writes the database file to disk.
+// The data goes to a temporary file that is synced and renamed over the old one,
+// so a crash leaves either the old or the new file, never a truncated one.
 func (db *DB) writeDB(dbStructure DBStructure) error {
-	db.mux.Lock()
-	defer db.mux.Unlock()
-
 	dat, err := json.Marshal(dbStructure)
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile(db.path, dat, 0666)
+	return db.writeFile(dat)
+}
+
+// writeFile atomically replaces the database file with dat
+func (db *DB) writeFile(dat []byte) error {
+	dir := filepath.Dir(db.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(db.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(dat)
+	if err == nil {
+		err = tmp.Chmod(0666)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), db.path)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return syncDir(dir)
+}
+
+// nextID allocates a new ID for entity, never reusing one that was handed out before.
+// The returned operation persists the sequence and must be committed with the record.
+// Callers must hold the write lock.
+func (db *DB) nextID(entity string) (int, walOp) {
+	ID := db.data.Sequences[entity] + 1
+	if db.snowflake != nil {
+		ID = max(ID, db.snowflake.Next())
+	}
+
+	return ID, putOp("sequences", entity, ID)
 }
 
 // loadDB reads the database file into memory
 func (db *DB) loadDB() (DBStructure, error) {
-	db.mux.Lock()
-	defer db.mux.Unlock()
-
 	dbStructure := DBStructure{}
 	dat, err := os.ReadFile(db.path)
 	if err != nil {
@@ -84,13 +223,35 @@ func (db *DB) loadDB() (DBStructure, error) {
 	if err != nil {
 		return dbStructure, err
 	}
+	if dbStructure.SchemaVersion != currentSchemaVersion {
+		return dbStructure, fmt.Errorf("database schema version %d, expected %d", dbStructure.SchemaVersion, currentSchemaVersion)
+	}
 
 	return dbStructure, nil
 }
 
+// Close folds the write-ahead log into the database file
+func (db *DB) Close() error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	return db.compact()
+}
+
 // DeleteFromDB deletes a resource from the database
 func (db *DB) DeleteFromDB() {
 	db.mux.Lock()
 	defer db.mux.Unlock()
 
 }
+
+// syncDir flushes a directory entry so a rename inside it survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
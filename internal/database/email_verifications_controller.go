@@ -0,0 +1,103 @@
+package database
+
+import (
+	"time"
+)
+
+// EmailVerification is a one-time token proving that a user owns an email.
+// When Email isn't the current email of the user, using the token changes it.
+// Only the hash of the token is kept, and only the latest token of a user works.
+type EmailVerification struct {
+	TokenHash string
+	UserID    int
+	Email     string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// CreateEmailVerification saves a new verification token, replacing the previous ones of the user
+func (db *DB) CreateEmailVerification(verification EmailVerification) (EmailVerification, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	if _, ok := db.data.Users[verification.UserID]; !ok {
+		return EmailVerification{}, ErrNotExist
+	}
+	verification.CreatedAt = time.Now().UTC()
+
+	ops := db.deleteEmailVerificationsOps(verification.UserID)
+	ops = append(ops, putOp("email_verifications", verification.TokenHash, verification))
+
+	err := db.commit(ops...)
+	if err != nil {
+		return EmailVerification{}, err
+	}
+
+	return verification, nil
+}
+
+// VerifyEmail marks the email of the token as verified, switching the user to it
+// when it was a pending change, and uses the token up
+func (db *DB) VerifyEmail(tokenHash string) (User, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	verification, ok := db.data.EmailVerifications[tokenHash]
+	if !ok {
+		return User{}, ErrNotExist
+	}
+	if !time.Now().UTC().Before(verification.ExpiresAt) {
+		return User{}, ErrTokenExpired
+	}
+	user, ok := db.data.Users[verification.UserID]
+	if !ok {
+		return User{}, ErrNotExist
+	}
+	if key, ok := db.usersByEmail[emailKey(verification.Email)]; ok && key != user.ID {
+		return User{}, ErrEmailTaken
+	}
+	user.Email = verification.Email
+	user.Verified = true
+
+	ops := db.deleteEmailVerificationsOps(user.ID)
+	ops = append(ops, putOp("users", user.ID, user))
+
+	err := db.commit(ops...)
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// deleteEmailVerificationsOps returns the operations deleting the verification tokens of the user.
+// Callers must hold the write lock.
+func (db *DB) deleteEmailVerificationsOps(userID int) []walOp {
+	ops := []walOp{}
+	for hash, verification := range db.data.EmailVerifications {
+		if verification.UserID == userID {
+			ops = append(ops, deleteOp("email_verifications", hash))
+		}
+	}
+
+	return ops
+}
+
+// DeleteExpiredEmailVerifications removes the verification tokens that expired before the time
+// and returns how many were removed
+func (db *DB) DeleteExpiredEmailVerifications(before time.Time) (int, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	ops := []walOp{}
+	for hash, verification := range db.data.EmailVerifications {
+		if verification.ExpiresAt.Before(before) {
+			ops = append(ops, deleteOp("email_verifications", hash))
+		}
+	}
+	if len(ops) == 0 {
+		return 0, nil
+	}
+
+	return len(ops), db.commit(ops...)
+}
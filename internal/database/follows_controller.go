@@ -0,0 +1,100 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type Follow struct {
+	FollowerID int
+	FolloweeID int
+	CreatedAt  time.Time
+}
+
+// FollowQuery selects a page of follows ordered by the listed user ID
+type FollowQuery struct {
+	// AfterID continues after the user with this ID when not zero
+	AfterID int
+	// Limit is the maximum number of follows returned, zero for no limit
+	Limit int
+}
+
+// followKey is the key of a follow in DBStructure.Follows
+func followKey(followerID, followeeID int) string {
+	return fmt.Sprintf("%d:%d", followerID, followeeID)
+}
+
+// FollowUser makes the follower follow the followee.
+// Following a user twice keeps the original follow.
+func (db *DB) FollowUser(followerID, followeeID int) (Follow, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	key := followKey(followerID, followeeID)
+	if follow, ok := db.data.Follows[key]; ok {
+		return follow, nil
+	}
+
+	follow := Follow{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	err := db.commit(putOp("follows", key, follow))
+	if err != nil {
+		return Follow{}, err
+	}
+
+	return follow, nil
+}
+
+// UnfollowUser removes the follow between the follower and the followee
+func (db *DB) UnfollowUser(followerID, followeeID int) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	key := followKey(followerID, followeeID)
+	if _, ok := db.data.Follows[key]; !ok {
+		return ErrNotExist
+	}
+
+	return db.commit(deleteOp("follows", key))
+}
+
+// GetFollowers returns a page of the follows pointing to the user, ordered by follower ID
+func (db *DB) GetFollowers(userID int, query FollowQuery) ([]Follow, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	return db.pageFollows(db.followers[userID], query, func(followerID int) string {
+		return followKey(followerID, userID)
+	}), nil
+}
+
+// GetFollowing returns a page of the follows made by the user, ordered by followee ID
+func (db *DB) GetFollowing(userID int, query FollowQuery) ([]Follow, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	return db.pageFollows(db.following[userID], query, func(followeeID int) string {
+		return followKey(userID, followeeID)
+	}), nil
+}
+
+// pageFollows returns the follows of the sorted user IDs after the query cursor.
+// Callers must hold the lock.
+func (db *DB) pageFollows(userIDs []int, query FollowQuery, key func(int) string) []Follow {
+	start := sort.SearchInts(userIDs, query.AfterID+1)
+
+	follows := []Follow{}
+	for _, userID := range userIDs[start:] {
+		if query.Limit > 0 && len(follows) >= query.Limit {
+			break
+		}
+		follows = append(follows, db.data.Follows[key(userID)])
+	}
+
+	return follows
+}
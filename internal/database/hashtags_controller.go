@@ -0,0 +1,76 @@
+package database
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// TrendingQuery selects the hashtags used in a time window
+type TrendingQuery struct {
+	// Since and Until bound the creation time of the chirps counted
+	Since time.Time
+	Until time.Time
+	// HalfLife is the age at which a use counts half as much as a use at Until
+	HalfLife time.Duration
+	// Limit is the maximum number of hashtags returned, zero for no limit
+	Limit int
+}
+
+// TrendingHashtag is a hashtag ranked by its time-decayed usage
+type TrendingHashtag struct {
+	Tag   string
+	Uses  int
+	Score float64
+}
+
+// rankHashtags scores the uses of each hashtag, halving the weight of a use
+// every query.HalfLife before query.Until, and returns the highest scores first
+func rankHashtags(uses map[string][]time.Time, query TrendingQuery) []TrendingHashtag {
+	trending := make([]TrendingHashtag, 0, len(uses))
+	for tag, times := range uses {
+		hashtag := TrendingHashtag{Tag: tag, Uses: len(times)}
+		for _, usedAt := range times {
+			age := query.Until.Sub(usedAt)
+			hashtag.Score += math.Exp2(-age.Seconds() / query.HalfLife.Seconds())
+		}
+		trending = append(trending, hashtag)
+	}
+
+	sort.Slice(trending, func(i, j int) bool {
+		if trending[i].Score != trending[j].Score {
+			return trending[i].Score > trending[j].Score
+		}
+		return trending[i].Tag < trending[j].Tag
+	})
+
+	if query.Limit > 0 && len(trending) > query.Limit {
+		trending = trending[:query.Limit]
+	}
+
+	return trending
+}
+
+// GetTrendingHashtags returns the hashtags of the chirps created in the query window,
+// ranked by time-decayed usage
+func (db *DB) GetTrendingHashtags(query TrendingQuery) ([]TrendingHashtag, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	uses := map[string][]time.Time{}
+	IDs := db.chirpOrders[ChirpSortCreated]
+	for i := len(IDs) - 1; i >= 0; i-- {
+		chirp := db.data.Chirps[IDs[i]]
+		if chirp.CreatedAt.Before(query.Since) {
+			break
+		}
+		if chirp.CreatedAt.After(query.Until) || chirp.Deleted || chirp.Hidden {
+			continue
+		}
+		for _, tag := range chirp.Hashtags {
+			uses[tag] = append(uses[tag], chirp.CreatedAt)
+		}
+	}
+
+	return rankHashtags(uses, query), nil
+}
@@ -0,0 +1,347 @@
+package database
+
+import (
+	"sort"
+	"strings"
+)
+
+// rebuildIndexes recomputes the secondary indexes from the in-memory structure
+func (db *DB) rebuildIndexes() {
+	db.usersByEmail = map[string]int{}
+	db.usersByHandle = map[string]int{}
+	db.chirpOrders = map[ChirpSort][]int{}
+	db.chirpsByAuthor = map[int][]int{}
+	db.repliesTo = map[int][]int{}
+	db.likesByChirp = map[int][]int{}
+	db.chirpsByTag = map[string][]int{}
+	db.chirpsMentioning = map[int][]int{}
+	db.searchPostings = map[string]map[int][]int{}
+	db.searchLengths = map[int]int{}
+	db.searchTotalLength = 0
+	db.reportsByStatus = map[ReportStatus][]int{}
+	db.refreshTokenFamilies = map[string][]string{}
+	db.sessionsByUser = map[int][]string{}
+	db.actionsByReport = map[int][]int{}
+	db.following = map[int][]int{}
+	db.followers = map[int][]int{}
+
+	for key, user := range db.data.Users {
+		db.indexUser(key, user)
+	}
+	for key, follow := range db.data.Follows {
+		db.indexFollow(key, follow)
+	}
+	for key, like := range db.data.Likes {
+		db.indexLike(key, like)
+	}
+	for key, token := range db.data.RefreshTokens {
+		db.indexRefreshToken(key, token)
+	}
+	for key, session := range db.data.Sessions {
+		db.indexSession(key, session)
+	}
+	for key, report := range db.data.Reports {
+		db.indexReport(key, report)
+	}
+	for key, action := range db.data.ReportActions {
+		db.indexReportAction(key, action)
+	}
+
+	for key, chirp := range db.data.Chirps {
+		for _, sortBy := range chirpSorts {
+			db.chirpOrders[sortBy] = append(db.chirpOrders[sortBy], key)
+		}
+		db.chirpsByAuthor[chirp.AuthorID] = append(db.chirpsByAuthor[chirp.AuthorID], key)
+		if chirp.InReplyTo != 0 {
+			db.repliesTo[chirp.InReplyTo] = append(db.repliesTo[chirp.InReplyTo], key)
+		}
+		for _, tag := range chirp.Hashtags {
+			db.chirpsByTag[tag] = append(db.chirpsByTag[tag], key)
+		}
+		for _, userID := range chirp.MentionedUserIDs() {
+			db.chirpsMentioning[userID] = append(db.chirpsMentioning[userID], key)
+		}
+		db.indexChirpText(key, chirp)
+	}
+	for _, sortBy := range chirpSorts {
+		IDs := db.chirpOrders[sortBy]
+		sort.Slice(IDs, func(i, j int) bool {
+			return db.data.Chirps[IDs[i]].Cursor(sortBy).less(db.data.Chirps[IDs[j]].Cursor(sortBy))
+		})
+	}
+	for _, IDs := range db.chirpsByAuthor {
+		sort.Ints(IDs)
+	}
+	for _, IDs := range db.repliesTo {
+		sort.Ints(IDs)
+	}
+	for _, IDs := range db.chirpsByTag {
+		sort.Ints(IDs)
+	}
+	for _, IDs := range db.chirpsMentioning {
+		sort.Ints(IDs)
+	}
+}
+
+// chirpSorts lists the sort orders kept as indexes
+var chirpSorts = []ChirpSort{ChirpSortID, ChirpSortCreated, ChirpSortUpdated, ChirpSortLikes}
+
+// emailKey normalises an email for case-insensitive lookups
+func emailKey(email string) string {
+	return strings.ToLower(email)
+}
+
+// handleKey normalises a handle for case-insensitive lookups
+func handleKey(handle string) string {
+	return strings.ToLower(handle)
+}
+
+func (db *DB) indexUser(key int, user User) {
+	db.usersByEmail[emailKey(user.Email)] = key
+	if user.Handle != "" {
+		db.usersByHandle[handleKey(user.Handle)] = key
+	}
+}
+
+func (db *DB) unindexUser(key int, user User) {
+	if db.usersByEmail[emailKey(user.Email)] == key {
+		delete(db.usersByEmail, emailKey(user.Email))
+	}
+	if user.Handle != "" && db.usersByHandle[handleKey(user.Handle)] == key {
+		delete(db.usersByHandle, handleKey(user.Handle))
+	}
+}
+
+func (db *DB) indexChirp(key int, chirp Chirp) {
+	for _, sortBy := range chirpSorts {
+		db.chirpOrders[sortBy] = db.insertChirpOrder(db.chirpOrders[sortBy], sortBy, chirp)
+	}
+	db.chirpsByAuthor[chirp.AuthorID] = insertSorted(db.chirpsByAuthor[chirp.AuthorID], key)
+	if chirp.InReplyTo != 0 {
+		db.repliesTo[chirp.InReplyTo] = insertSorted(db.repliesTo[chirp.InReplyTo], key)
+	}
+	for _, tag := range chirp.Hashtags {
+		db.chirpsByTag[tag] = insertSorted(db.chirpsByTag[tag], key)
+	}
+	for _, userID := range chirp.MentionedUserIDs() {
+		db.chirpsMentioning[userID] = insertSorted(db.chirpsMentioning[userID], key)
+	}
+	db.indexChirpText(key, chirp)
+}
+
+// indexChirpText adds the words of a chirp body to the full-text index.
+// Tombstones have no body, so they are never found.
+func (db *DB) indexChirpText(key int, chirp Chirp) {
+	tokens := tokenize(chirp.Body)
+	if len(tokens) == 0 {
+		return
+	}
+
+	for term, positions := range termPositions(tokens) {
+		if db.searchPostings[term] == nil {
+			db.searchPostings[term] = map[int][]int{}
+		}
+		db.searchPostings[term][key] = positions
+	}
+	db.searchLengths[key] = len(tokens)
+	db.searchTotalLength += len(tokens)
+}
+
+func (db *DB) unindexChirpText(key int, chirp Chirp) {
+	length, ok := db.searchLengths[key]
+	if !ok {
+		return
+	}
+
+	for term := range termPositions(tokenize(chirp.Body)) {
+		delete(db.searchPostings[term], key)
+		if len(db.searchPostings[term]) == 0 {
+			delete(db.searchPostings, term)
+		}
+	}
+	delete(db.searchLengths, key)
+	db.searchTotalLength -= length
+}
+
+func (db *DB) unindexChirp(key int, chirp Chirp) {
+	for _, sortBy := range chirpSorts {
+		db.chirpOrders[sortBy] = db.removeChirpOrder(db.chirpOrders[sortBy], sortBy, chirp)
+	}
+	keys := removeSorted(db.chirpsByAuthor[chirp.AuthorID], key)
+	if len(keys) == 0 {
+		delete(db.chirpsByAuthor, chirp.AuthorID)
+	} else {
+		db.chirpsByAuthor[chirp.AuthorID] = keys
+	}
+	if chirp.InReplyTo != 0 {
+		replies := removeSorted(db.repliesTo[chirp.InReplyTo], key)
+		if len(replies) == 0 {
+			delete(db.repliesTo, chirp.InReplyTo)
+		} else {
+			db.repliesTo[chirp.InReplyTo] = replies
+		}
+	}
+	for _, tag := range chirp.Hashtags {
+		tagged := removeSorted(db.chirpsByTag[tag], key)
+		if len(tagged) == 0 {
+			delete(db.chirpsByTag, tag)
+		} else {
+			db.chirpsByTag[tag] = tagged
+		}
+	}
+	for _, userID := range chirp.MentionedUserIDs() {
+		mentioning := removeSorted(db.chirpsMentioning[userID], key)
+		if len(mentioning) == 0 {
+			delete(db.chirpsMentioning, userID)
+		} else {
+			db.chirpsMentioning[userID] = mentioning
+		}
+	}
+	db.unindexChirpText(key, chirp)
+}
+
+func (db *DB) indexFollow(key string, follow Follow) {
+	db.following[follow.FollowerID] = insertSorted(db.following[follow.FollowerID], follow.FolloweeID)
+	db.followers[follow.FolloweeID] = insertSorted(db.followers[follow.FolloweeID], follow.FollowerID)
+}
+
+func (db *DB) unindexFollow(key string, follow Follow) {
+	db.following[follow.FollowerID] = removeSorted(db.following[follow.FollowerID], follow.FolloweeID)
+	if len(db.following[follow.FollowerID]) == 0 {
+		delete(db.following, follow.FollowerID)
+	}
+	db.followers[follow.FolloweeID] = removeSorted(db.followers[follow.FolloweeID], follow.FollowerID)
+	if len(db.followers[follow.FolloweeID]) == 0 {
+		delete(db.followers, follow.FolloweeID)
+	}
+}
+
+func (db *DB) indexLike(key string, like Like) {
+	db.likesByChirp[like.ChirpID] = insertSorted(db.likesByChirp[like.ChirpID], like.UserID)
+}
+
+func (db *DB) unindexLike(key string, like Like) {
+	db.likesByChirp[like.ChirpID] = removeSorted(db.likesByChirp[like.ChirpID], like.UserID)
+	if len(db.likesByChirp[like.ChirpID]) == 0 {
+		delete(db.likesByChirp, like.ChirpID)
+	}
+}
+
+func (db *DB) indexReport(key int, report Report) {
+	db.reportsByStatus[report.Status] = insertSorted(db.reportsByStatus[report.Status], key)
+}
+
+func (db *DB) unindexReport(key int, report Report) {
+	db.reportsByStatus[report.Status] = removeSorted(db.reportsByStatus[report.Status], key)
+	if len(db.reportsByStatus[report.Status]) == 0 {
+		delete(db.reportsByStatus, report.Status)
+	}
+}
+
+func (db *DB) indexReportAction(key int, action ReportAction) {
+	db.actionsByReport[action.ReportID] = insertSorted(db.actionsByReport[action.ReportID], key)
+}
+
+func (db *DB) indexRefreshToken(key string, token RefreshToken) {
+	family := db.refreshTokenFamilies[token.FamilyID]
+	for _, ID := range family {
+		if ID == key {
+			return
+		}
+	}
+	db.refreshTokenFamilies[token.FamilyID] = append(family, key)
+}
+
+func (db *DB) unindexRefreshToken(key string, token RefreshToken) {
+	family := db.refreshTokenFamilies[token.FamilyID]
+	for i, ID := range family {
+		if ID == key {
+			family = append(family[:i], family[i+1:]...)
+			break
+		}
+	}
+	if len(family) == 0 {
+		delete(db.refreshTokenFamilies, token.FamilyID)
+	} else {
+		db.refreshTokenFamilies[token.FamilyID] = family
+	}
+}
+
+func (db *DB) indexSession(key string, session Session) {
+	sessions := db.sessionsByUser[session.UserID]
+	for _, ID := range sessions {
+		if ID == key {
+			return
+		}
+	}
+	db.sessionsByUser[session.UserID] = append(sessions, key)
+}
+
+func (db *DB) unindexSession(key string, session Session) {
+	sessions := db.sessionsByUser[session.UserID]
+	for i, ID := range sessions {
+		if ID == key {
+			sessions = append(sessions[:i], sessions[i+1:]...)
+			break
+		}
+	}
+	if len(sessions) == 0 {
+		delete(db.sessionsByUser, session.UserID)
+	} else {
+		db.sessionsByUser[session.UserID] = sessions
+	}
+}
+
+// insertChirpOrder adds the chirp to IDs, sorted by sortBy
+func (db *DB) insertChirpOrder(IDs []int, sortBy ChirpSort, chirp Chirp) []int {
+	key := chirp.Cursor(sortBy)
+	i := sort.Search(len(IDs), func(i int) bool {
+		return !db.data.Chirps[IDs[i]].Cursor(sortBy).less(key)
+	})
+
+	IDs = append(IDs, 0)
+	copy(IDs[i+1:], IDs[i:])
+	IDs[i] = chirp.ID
+	return IDs
+}
+
+// removeChirpOrder removes the chirp from IDs, sorted by sortBy.
+// The chirp must still hold the values it was indexed with.
+func (db *DB) removeChirpOrder(IDs []int, sortBy ChirpSort, chirp Chirp) []int {
+	key := chirp.Cursor(sortBy)
+	i := sort.Search(len(IDs), func(i int) bool {
+		return !db.data.Chirps[IDs[i]].Cursor(sortBy).less(key)
+	})
+	if i == len(IDs) || IDs[i] != chirp.ID {
+		return IDs
+	}
+
+	return append(IDs[:i], IDs[i+1:]...)
+}
+
+// insertSorted adds value to the ascending slice.
+// IDs are allocated in increasing order, so this is almost always an append.
+func insertSorted(values []int, value int) []int {
+	i := sort.SearchInts(values, value)
+	if i < len(values) && values[i] == value {
+		return values
+	}
+	if i == len(values) {
+		return append(values, value)
+	}
+
+	values = append(values, 0)
+	copy(values[i+1:], values[i:])
+	values[i] = value
+	return values
+}
+
+// removeSorted removes value from the ascending slice
+func removeSorted(values []int, value int) []int {
+	i := sort.SearchInts(values, value)
+	if i == len(values) || values[i] != value {
+		return values
+	}
+
+	return append(values[:i], values[i+1:]...)
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+type Like struct {
+	UserID    int
+	ChirpID   int
+	CreatedAt time.Time
+}
+
+// likeKey is the key of a like in DBStructure.Likes
+func likeKey(userID, chirpID int) string {
+	return fmt.Sprintf("%d:%d", userID, chirpID)
+}
+
+// LikeChirp records that the user likes the chirp and returns the chirp with its new count.
+// Liking a chirp twice keeps a single like.
+func (db *DB) LikeChirp(userID, chirpID int) (Chirp, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	chirp, ok := db.data.Chirps[chirpID]
+	if !ok || chirp.Deleted || chirp.Hidden {
+		return Chirp{}, ErrNotExist
+	}
+
+	key := likeKey(userID, chirpID)
+	if _, ok := db.data.Likes[key]; ok {
+		return chirp, nil
+	}
+
+	like := Like{
+		UserID:    userID,
+		ChirpID:   chirpID,
+		CreatedAt: time.Now().UTC(),
+	}
+	chirp.LikeCount++
+
+	err := db.commit(putOp("likes", key, like), putOp("chirps", chirp.ID, chirp))
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return chirp, nil
+}
+
+// UnlikeChirp removes the like of the user from the chirp and returns the chirp with its new count
+func (db *DB) UnlikeChirp(userID, chirpID int) (Chirp, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	chirp, ok := db.data.Chirps[chirpID]
+	if !ok || chirp.Deleted || chirp.Hidden {
+		return Chirp{}, ErrNotExist
+	}
+
+	key := likeKey(userID, chirpID)
+	if _, ok := db.data.Likes[key]; !ok {
+		return chirp, nil
+	}
+
+	chirp.LikeCount--
+
+	err := db.commit(deleteOp("likes", key), putOp("chirps", chirp.ID, chirp))
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return chirp, nil
+}
+
+// GetLikedChirps returns which of the chirps the user likes
+func (db *DB) GetLikedChirps(userID int, chirpIDs []int) (map[int]bool, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	liked := map[int]bool{}
+	for _, chirpID := range chirpIDs {
+		if _, ok := db.data.Likes[likeKey(userID, chirpID)]; ok {
+			liked[chirpID] = true
+		}
+	}
+
+	return liked, nil
+}
+
+// deleteChirpOps returns the operations removing a chirp and its likes.
+// Callers must hold the write lock.
+func (db *DB) deleteChirpOps(chirpID int) []walOp {
+	ops := []walOp{deleteOp("chirps", chirpID)}
+	for _, userID := range db.likesByChirp[chirpID] {
+		ops = append(ops, deleteOp("likes", likeKey(userID, chirpID)))
+	}
+
+	return ops
+}
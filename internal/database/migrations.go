@@ -0,0 +1,628 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rawDocument is the database file decoded only down to its top-level keys,
+// so that migrations can reshape data the current structs can't represent
+type rawDocument map[string]json.RawMessage
+
+// migration upgrades a database document from Version-1 to Version.
+// up returns a human-readable description of every change it made.
+type migration struct {
+	Version     int
+	Description string
+	up          func(doc rawDocument) ([]string, error)
+}
+
+// migrations is the registry of schema upgrades, in version order.
+// Add new steps at the end; currentSchemaVersion follows automatically.
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "add schema_version and ensure every collection exists",
+		up: func(doc rawDocument) ([]string, error) {
+			return ensureCollections(doc, "chirps", "users", "revoked_tokens"), nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "key chirps by ID and add per-entity ID sequences",
+		up:          migrateIDSequences,
+	},
+	{
+		Version:     3,
+		Description: "add created_at and updated_at to chirps",
+		up:          migrateChirpTimestamps,
+	},
+	{
+		Version:     4,
+		Description: "add the follows collection",
+		up: func(doc rawDocument) ([]string, error) {
+			return ensureCollections(doc, "follows"), nil
+		},
+	},
+	{
+		Version:     5,
+		Description: "add InReplyTo and Deleted to chirps",
+		up: func(doc rawDocument) ([]string, error) {
+			return addFieldDefaults(doc, "chirps", map[string]any{
+				"InReplyTo": 0,
+				"Deleted":   false,
+			})
+		},
+	},
+	{
+		Version:     6,
+		Description: "add the likes collection and LikeCount to chirps",
+		up: func(doc rawDocument) ([]string, error) {
+			changes := ensureCollections(doc, "likes")
+			fieldChanges, err := addFieldDefaults(doc, "chirps", map[string]any{
+				"LikeCount": 0,
+			})
+			return append(changes, fieldChanges...), err
+		},
+	},
+	{
+		Version:     7,
+		Description: "add RechirpOf, RechirpCount and QuoteCount to chirps",
+		up: func(doc rawDocument) ([]string, error) {
+			return addFieldDefaults(doc, "chirps", map[string]any{
+				"RechirpOf":    0,
+				"RechirpCount": 0,
+				"QuoteCount":   0,
+			})
+		},
+	},
+	{
+		Version:     8,
+		Description: "add Hashtags to chirps",
+		up: func(doc rawDocument) ([]string, error) {
+			return addFieldDefaults(doc, "chirps", map[string]any{
+				"Hashtags": []string{},
+			})
+		},
+	},
+	{
+		Version:     9,
+		Description: "add Handle to users and Mentions to chirps",
+		up: func(doc rawDocument) ([]string, error) {
+			changes, err := addFieldDefaults(doc, "users", map[string]any{
+				"Handle": "",
+			})
+			if err != nil {
+				return nil, err
+			}
+			chirpChanges, err := addFieldDefaults(doc, "chirps", map[string]any{
+				"Mentions": []Mention{},
+			})
+			return append(changes, chirpChanges...), err
+		},
+	},
+	{
+		Version:     10,
+		Description: "add Flagged to chirps",
+		up: func(doc rawDocument) ([]string, error) {
+			return addFieldDefaults(doc, "chirps", map[string]any{
+				"Flagged": false,
+			})
+		},
+	},
+	{
+		Version:     11,
+		Description: "add the reports and report_actions collections and Suspended to users",
+		up: func(doc rawDocument) ([]string, error) {
+			changes := ensureCollections(doc, "reports", "report_actions")
+			fieldChanges, err := addFieldDefaults(doc, "users", map[string]any{
+				"Suspended": false,
+			})
+			return append(changes, fieldChanges...), err
+		},
+	},
+	{
+		Version:     12,
+		Description: "add Role to users",
+		up: func(doc rawDocument) ([]string, error) {
+			return addFieldDefaults(doc, "users", map[string]any{
+				"Role": RoleUser,
+			})
+		},
+	},
+	{
+		Version:     13,
+		Description: "replace revoked_tokens with refresh_tokens tracked by jti",
+		up: func(doc rawDocument) ([]string, error) {
+			changes := dropCollections(doc, "revoked_tokens")
+			return append(changes, ensureCollections(doc, "refresh_tokens")...), nil
+		},
+	},
+	{
+		Version:     14,
+		Description: "add the sessions collection with a session for every refresh token family",
+		up:          migrateRefreshTokenSessions,
+	},
+	{
+		Version:     15,
+		Description: "add the password_resets collection",
+		up: func(doc rawDocument) ([]string, error) {
+			return ensureCollections(doc, "password_resets"), nil
+		},
+	},
+	{
+		Version:     16,
+		Description: "add the email_verifications collection and Verified to users",
+		up: func(doc rawDocument) ([]string, error) {
+			changes := ensureCollections(doc, "email_verifications")
+			fieldChanges, err := addFieldDefaults(doc, "users", map[string]any{
+				"Verified": false,
+			})
+			return append(changes, fieldChanges...), err
+		},
+	},
+	{
+		Version:     17,
+		Description: "add the totp collection",
+		up: func(doc rawDocument) ([]string, error) {
+			return ensureCollections(doc, "totp"), nil
+		},
+	},
+	{
+		Version:     18,
+		Description: "add Hidden to chirps",
+		up: func(doc rawDocument) ([]string, error) {
+			return addFieldDefaults(doc, "chirps", map[string]any{
+				"Hidden": false,
+			})
+		},
+	},
+}
+
+// currentSchemaVersion is the schema version written by this build
+var currentSchemaVersion = migrations[len(migrations)-1].Version
+
+// ErrSchemaTooNew is returned when the file was written by a newer build
+var ErrSchemaTooNew = errors.New("database schema is newer than this build supports")
+
+// MigrationStep describes one migration applied to the database file
+type MigrationStep struct {
+	Version     int
+	Description string
+	Changes     []string
+}
+
+// MigrationReport describes the upgrade of a database file
+type MigrationReport struct {
+	FromVersion        int
+	ToVersion          int
+	ReplayedLogEntries int
+	Steps              []MigrationStep
+}
+
+// MigrateFile upgrades the JSON database file at path to the current schema version.
+// With dryRun set the file is left untouched and the report shows what would change.
+func MigrateFile(path string, dryRun bool) (MigrationReport, error) {
+	db := &DB{
+		path:    path,
+		walPath: path + ".wal",
+	}
+	return db.migrate(dryRun)
+}
+
+// migrate upgrades the database file step by step to currentSchemaVersion
+func (db *DB) migrate(dryRun bool) (MigrationReport, error) {
+	report := MigrationReport{}
+
+	dat, err := os.ReadFile(db.path)
+	if err != nil {
+		return report, err
+	}
+
+	doc := rawDocument{}
+	err = json.Unmarshal(dat, &doc)
+	if err != nil {
+		return report, err
+	}
+
+	version := 0
+	if rawVersion, ok := doc["schema_version"]; ok {
+		err = json.Unmarshal(rawVersion, &version)
+		if err != nil {
+			return report, fmt.Errorf("invalid schema_version: %w", err)
+		}
+	}
+
+	report.FromVersion = version
+	report.ToVersion = version
+	if version > currentSchemaVersion {
+		return report, ErrSchemaTooNew
+	}
+	if version == currentSchemaVersion {
+		return report, nil
+	}
+
+	// Log entries were written in the old format, fold them in before upgrading
+	report.ReplayedLogEntries, err = db.replayWALRaw(doc)
+	if err != nil {
+		return report, err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+
+		changes, err := m.up(doc)
+		if err != nil {
+			return report, fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+
+		doc["schema_version"] = json.RawMessage(fmt.Sprint(m.Version))
+		report.ToVersion = m.Version
+		report.Steps = append(report.Steps, MigrationStep{
+			Version:     m.Version,
+			Description: m.Description,
+			Changes:     changes,
+		})
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	dat, err = json.Marshal(doc)
+	if err != nil {
+		return report, err
+	}
+
+	err = db.writeFile(dat)
+	if err != nil {
+		return report, err
+	}
+
+	err = os.Remove(db.walPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// replayWALRaw applies the write-ahead log to the raw document
+// and returns the number of entries applied
+func (db *DB) replayWALRaw(doc rawDocument) (int, error) {
+	entries, err := db.readWAL()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		collection := map[string]json.RawMessage{}
+		if raw, ok := doc[entry.Collection]; ok && string(raw) != "null" {
+			err := json.Unmarshal(raw, &collection)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		switch entry.Op {
+		case walOpPut:
+			collection[entry.Key] = entry.Value
+		case walOpDelete:
+			delete(collection, entry.Key)
+		default:
+			return 0, fmt.Errorf("unknown write-ahead log operation: %s", entry.Op)
+		}
+
+		dat, err := json.Marshal(collection)
+		if err != nil {
+			return 0, err
+		}
+		doc[entry.Collection] = dat
+	}
+
+	return len(entries), nil
+}
+
+// migrateIDSequences re-keys the chirps by their ID, giving fresh IDs to chirps
+// that collided, and seeds the sequences with the highest IDs in use
+func migrateIDSequences(doc rawDocument) ([]string, error) {
+	changes := []string{}
+
+	chirps := map[string]json.RawMessage{}
+	err := json.Unmarshal(doc["chirps"], &chirps)
+	if err != nil {
+		return nil, err
+	}
+	users := map[string]json.RawMessage{}
+	err = json.Unmarshal(doc["users"], &users)
+	if err != nil {
+		return nil, err
+	}
+
+	// visit chirps in key order so that the oldest chirp keeps a duplicated ID
+	keys := make([]int, 0, len(chirps))
+	for key := range chirps {
+		k, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	maxChirpID := 0
+	for _, raw := range chirps {
+		record := struct{ ID int }{}
+		err := json.Unmarshal(raw, &record)
+		if err != nil {
+			return nil, err
+		}
+		maxChirpID = max(maxChirpID, record.ID)
+	}
+
+	rekeyed := map[string]json.RawMessage{}
+	for _, key := range keys {
+		raw := chirps[strconv.Itoa(key)]
+		record := struct{ ID int }{}
+		err := json.Unmarshal(raw, &record)
+		if err != nil {
+			return nil, err
+		}
+
+		ID := record.ID
+		if _, taken := rekeyed[strconv.Itoa(ID)]; taken {
+			maxChirpID++
+			changes = append(changes, fmt.Sprintf("give duplicated chirp ID %d the new ID %d", ID, maxChirpID))
+			ID = maxChirpID
+
+			fields := map[string]json.RawMessage{}
+			err = json.Unmarshal(raw, &fields)
+			if err != nil {
+				return nil, err
+			}
+			fields["ID"] = json.RawMessage(strconv.Itoa(ID))
+			raw, err = json.Marshal(fields)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if ID != key {
+			changes = append(changes, fmt.Sprintf("move chirp %d from key %d", ID, key))
+		}
+		rekeyed[strconv.Itoa(ID)] = raw
+	}
+
+	maxUserID := 0
+	for key := range users {
+		ID, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, err
+		}
+		maxUserID = max(maxUserID, ID)
+	}
+
+	doc["chirps"], err = json.Marshal(rekeyed)
+	if err != nil {
+		return nil, err
+	}
+	doc["sequences"], err = json.Marshal(map[string]int{
+		"chirps": maxChirpID,
+		"users":  maxUserID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, fmt.Sprintf("start the chirps sequence at %d and the users sequence at %d", maxChirpID, maxUserID))
+
+	return changes, nil
+}
+
+// migrateChirpTimestamps backfills the chirp timestamps with the migration time,
+// the real creation time of older chirps was never recorded
+func migrateChirpTimestamps(doc rawDocument) ([]string, error) {
+	now := time.Now().UTC()
+	count, err := updateRecords(doc, "chirps", func(record map[string]json.RawMessage) (bool, error) {
+		if _, ok := record["CreatedAt"]; ok {
+			return false, nil
+		}
+
+		dat, err := json.Marshal(now)
+		if err != nil {
+			return false, err
+		}
+		record["CreatedAt"] = dat
+		record["UpdatedAt"] = dat
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if count == 0 {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("set created_at and updated_at of %d chirps to %s", count, now.Format(time.RFC3339))}, nil
+}
+
+// migrateRefreshTokenSessions creates a session for every refresh token family,
+// spanning from its first token to its last one
+func migrateRefreshTokenSessions(doc rawDocument) ([]string, error) {
+	changes := ensureCollections(doc, "sessions")
+
+	type tokenRecord struct {
+		FamilyID  string
+		UserID    int
+		RevokedAt time.Time
+		ExpiresAt time.Time
+		CreatedAt time.Time
+	}
+	tokens := map[string]tokenRecord{}
+	if raw, ok := doc["refresh_tokens"]; ok && string(raw) != "null" {
+		err := json.Unmarshal(raw, &tokens)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	type sessionRecord struct {
+		ID         string
+		UserID     int
+		UserAgent  string
+		IP         string
+		CreatedAt  time.Time
+		LastUsedAt time.Time
+		ExpiresAt  time.Time
+		RevokedAt  time.Time
+	}
+	sessions := map[string]json.RawMessage{}
+	err := json.Unmarshal(doc["sessions"], &sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	created := map[string]sessionRecord{}
+	for _, token := range tokens {
+		if _, ok := sessions[token.FamilyID]; ok {
+			continue
+		}
+		session, ok := created[token.FamilyID]
+		if !ok {
+			session = sessionRecord{
+				ID:         token.FamilyID,
+				UserID:     token.UserID,
+				CreatedAt:  token.CreatedAt,
+				LastUsedAt: token.CreatedAt,
+			}
+		}
+		if token.CreatedAt.Before(session.CreatedAt) {
+			session.CreatedAt = token.CreatedAt
+		}
+		if token.CreatedAt.After(session.LastUsedAt) {
+			session.LastUsedAt = token.CreatedAt
+		}
+		if token.ExpiresAt.After(session.ExpiresAt) {
+			session.ExpiresAt = token.ExpiresAt
+		}
+		if token.RevokedAt.After(session.RevokedAt) {
+			session.RevokedAt = token.RevokedAt
+		}
+		created[token.FamilyID] = session
+	}
+	if len(created) == 0 {
+		return changes, nil
+	}
+
+	for ID, session := range created {
+		sessions[ID], err = json.Marshal(session)
+		if err != nil {
+			return nil, err
+		}
+	}
+	doc["sessions"], err = json.Marshal(sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(changes, fmt.Sprintf("create %d sessions from the refresh token families", len(created))), nil
+}
+
+// addFieldDefaults sets the fields missing from the records of the collection
+// to their default value
+func addFieldDefaults(doc rawDocument, collection string, defaults map[string]any) ([]string, error) {
+	rawDefaults := map[string]json.RawMessage{}
+	for field, value := range defaults {
+		dat, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		rawDefaults[field] = dat
+	}
+
+	count, err := updateRecords(doc, collection, func(record map[string]json.RawMessage) (bool, error) {
+		changed := false
+		for field, value := range rawDefaults {
+			if _, ok := record[field]; !ok {
+				record[field] = value
+				changed = true
+			}
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if count == 0 {
+		return nil, nil
+	}
+	fields := make([]string, 0, len(defaults))
+	for field := range defaults {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return []string{fmt.Sprintf("set %s to their defaults in %d %s", strings.Join(fields, ", "), count, collection)}, nil
+}
+
+// updateRecords calls update on every record of the collection, decoded field by field,
+// and stores back the ones it changed. It returns the number of changed records.
+func updateRecords(doc rawDocument, collection string, update func(record map[string]json.RawMessage) (bool, error)) (int, error) {
+	records := map[string]map[string]json.RawMessage{}
+	err := json.Unmarshal(doc[collection], &records)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, record := range records {
+		changed, err := update(record)
+		if err != nil {
+			return 0, err
+		}
+		if changed {
+			count++
+		}
+	}
+
+	doc[collection], err = json.Marshal(records)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// dropCollections removes the named collections from the document
+func dropCollections(doc rawDocument, names ...string) []string {
+	changes := []string{}
+	for _, name := range names {
+		if _, ok := doc[name]; !ok {
+			continue
+		}
+		delete(doc, name)
+		changes = append(changes, fmt.Sprintf("drop %s collection", name))
+	}
+
+	return changes
+}
+
+// ensureCollections adds an empty object for every missing or null collection
+func ensureCollections(doc rawDocument, names ...string) []string {
+	changes := []string{}
+	for _, name := range names {
+		if raw, ok := doc[name]; ok && string(raw) != "null" {
+			continue
+		}
+		doc[name] = json.RawMessage("{}")
+		changes = append(changes, fmt.Sprintf("create empty %s collection", name))
+	}
+
+	return changes
+}
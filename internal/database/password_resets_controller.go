@@ -0,0 +1,88 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// PasswordReset is a one-time token letting a user choose a new password.
+// Only the hash of the token is kept; it is deleted once used.
+type PasswordReset struct {
+	TokenHash string
+	UserID    int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+var ErrTokenExpired = errors.New("the token has expired")
+
+// CreatePasswordReset saves a new password reset token
+func (db *DB) CreatePasswordReset(reset PasswordReset) (PasswordReset, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	if _, ok := db.data.Users[reset.UserID]; !ok {
+		return PasswordReset{}, ErrNotExist
+	}
+	reset.CreatedAt = time.Now().UTC()
+
+	err := db.commit(putOp("password_resets", reset.TokenHash, reset))
+	if err != nil {
+		return PasswordReset{}, err
+	}
+
+	return reset, nil
+}
+
+// ResetPassword sets the password of the user of the token, then deletes
+// every reset token of the user so that none of them can be used again
+func (db *DB) ResetPassword(tokenHash, password string) (User, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	reset, ok := db.data.PasswordResets[tokenHash]
+	if !ok {
+		return User{}, ErrNotExist
+	}
+	if !time.Now().UTC().Before(reset.ExpiresAt) {
+		return User{}, ErrTokenExpired
+	}
+	user, ok := db.data.Users[reset.UserID]
+	if !ok {
+		return User{}, ErrNotExist
+	}
+	user.Password = password
+
+	ops := []walOp{putOp("users", user.ID, user)}
+	for hash, other := range db.data.PasswordResets {
+		if other.UserID == user.ID {
+			ops = append(ops, deleteOp("password_resets", hash))
+		}
+	}
+
+	err := db.commit(ops...)
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// DeleteExpiredPasswordResets removes the reset tokens that expired before the time
+// and returns how many were removed
+func (db *DB) DeleteExpiredPasswordResets(before time.Time) (int, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	ops := []walOp{}
+	for hash, reset := range db.data.PasswordResets {
+		if reset.ExpiresAt.Before(before) {
+			ops = append(ops, deleteOp("password_resets", hash))
+		}
+	}
+	if len(ops) == 0 {
+		return 0, nil
+	}
+
+	return len(ops), db.commit(ops...)
+}
@@ -0,0 +1,310 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ReportStatus is the state of a report in the moderation queue
+type ReportStatus string
+
+const (
+	ReportOpen     ReportStatus = "open"
+	ReportClaimed  ReportStatus = "claimed"
+	ReportResolved ReportStatus = "resolved"
+)
+
+// Resolution is the outcome chosen by the moderator resolving a report
+type Resolution string
+
+const (
+	ResolutionHideChirp   Resolution = "hide_chirp"
+	ResolutionSuspendUser Resolution = "suspend_user"
+	ResolutionDismiss     Resolution = "dismiss"
+)
+
+// Actions recorded in the log of a report
+const (
+	ReportActionReport = "report"
+	ReportActionClaim  = "claim"
+	// ReportActionUnhide records a moderator showing again the chirp hidden by the report
+	ReportActionUnhide = "unhide_chirp"
+)
+
+var ErrReportClaimed = errors.New("report claimed by another moderator")
+var ErrReportResolved = errors.New("report already resolved")
+var ErrReportNotHidden = errors.New("report did not hide its chirp")
+var ErrSuspendStaff = errors.New("moderators and admins can't be suspended")
+
+type Report struct {
+	ID         int
+	ReporterID int
+	// ChirpID is the reported chirp, zero when a user is reported
+	ChirpID int
+	// UserID is the reported user, the author of the chirp for chirp reports
+	UserID  int
+	Reason  string
+	Details string
+	Status  ReportStatus
+	// ClaimedBy is the moderator handling the report, zero while it is open
+	ClaimedBy  int
+	Resolution Resolution
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// ReportAction is an entry of the log kept for every report.
+// Action is ReportActionReport, ReportActionClaim, ReportActionUnhide or the resolution of the report.
+type ReportAction struct {
+	ID        int
+	ReportID  int
+	ActorID   int
+	Action    string
+	Note      string
+	CreatedAt time.Time
+}
+
+type CreateReportParams struct {
+	ReporterID int
+	ChirpID    int
+	UserID     int
+	Reason     string
+	Details    string
+}
+
+// ReportQuery selects a page of reports ordered by ID
+type ReportQuery struct {
+	// Status lists only the reports in this state
+	Status ReportStatus
+	// AfterID continues after the report with this ID when not zero
+	AfterID int
+	// Limit is the maximum number of reports returned, zero for no limit
+	Limit int
+}
+
+// claim returns the report claimed by the moderator and the log entry recording it.
+// Claiming a report twice is allowed for the moderator already holding it.
+func (report Report) claim(moderatorID int, now time.Time) (Report, ReportAction, error) {
+	switch {
+	case report.Status == ReportResolved:
+		return Report{}, ReportAction{}, ErrReportResolved
+	case report.Status == ReportClaimed && report.ClaimedBy != moderatorID:
+		return Report{}, ReportAction{}, ErrReportClaimed
+	}
+
+	report.Status = ReportClaimed
+	report.ClaimedBy = moderatorID
+	report.UpdatedAt = now
+
+	return report, ReportAction{
+		ReportID:  report.ID,
+		ActorID:   moderatorID,
+		Action:    ReportActionClaim,
+		CreatedAt: now,
+	}, nil
+}
+
+// resolve returns the report resolved by the moderator and the log entry recording it.
+// Open reports are claimed on the way; reports claimed by someone else are refused.
+func (report Report) resolve(moderatorID int, resolution Resolution, note string, now time.Time) (Report, ReportAction, error) {
+	report, _, err := report.claim(moderatorID, now)
+	if err != nil {
+		return Report{}, ReportAction{}, err
+	}
+
+	report.Status = ReportResolved
+	report.Resolution = resolution
+
+	return report, ReportAction{
+		ReportID:  report.ID,
+		ActorID:   moderatorID,
+		Action:    string(resolution),
+		Note:      note,
+		CreatedAt: now,
+	}, nil
+}
+
+// unhide returns the report unchanged and the log entry recording the moderator
+// showing its chirp again. Only reports resolved by hiding their chirp have one to show.
+func (report Report) unhide(moderatorID int, note string, now time.Time) (Report, ReportAction, error) {
+	if report.Status != ReportResolved || report.Resolution != ResolutionHideChirp {
+		return Report{}, ReportAction{}, ErrReportNotHidden
+	}
+
+	return report, ReportAction{
+		ReportID:  report.ID,
+		ActorID:   moderatorID,
+		Action:    ReportActionUnhide,
+		Note:      note,
+		CreatedAt: now,
+	}, nil
+}
+
+// CreateReport files a new open report and logs it
+func (db *DB) CreateReport(params CreateReportParams) (Report, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	now := time.Now().UTC()
+	ID, sequenceOp := db.nextID("reports")
+	report := Report{
+		ID:         ID,
+		ReporterID: params.ReporterID,
+		ChirpID:    params.ChirpID,
+		UserID:     params.UserID,
+		Reason:     params.Reason,
+		Details:    params.Details,
+		Status:     ReportOpen,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	actionID, actionSequenceOp := db.nextID("report_actions")
+	action := ReportAction{
+		ID:        actionID,
+		ReportID:  ID,
+		ActorID:   params.ReporterID,
+		Action:    ReportActionReport,
+		Note:      params.Details,
+		CreatedAt: now,
+	}
+
+	err := db.commit(sequenceOp, putOp("reports", ID, report), actionSequenceOp, putOp("report_actions", actionID, action))
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+// GetReport returns the report with the corresponded id
+func (db *DB) GetReport(id int) (Report, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	report, ok := db.data.Reports[id]
+	if !ok {
+		return Report{}, ErrNotExist
+	}
+
+	return report, nil
+}
+
+// GetReports returns a page of the reports in the query status, oldest first
+func (db *DB) GetReports(query ReportQuery) ([]Report, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	IDs := db.reportsByStatus[query.Status]
+	start := sort.SearchInts(IDs, query.AfterID+1)
+
+	reports := []Report{}
+	for _, ID := range IDs[start:] {
+		if query.Limit > 0 && len(reports) >= query.Limit {
+			break
+		}
+		reports = append(reports, db.data.Reports[ID])
+	}
+
+	return reports, nil
+}
+
+// GetReportActions returns the log of the report in the order the actions were taken
+func (db *DB) GetReportActions(reportID int) ([]ReportAction, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	actions := []ReportAction{}
+	for _, ID := range db.actionsByReport[reportID] {
+		actions = append(actions, db.data.ReportActions[ID])
+	}
+
+	return actions, nil
+}
+
+// ClaimReport assigns the report to the moderator and logs it
+func (db *DB) ClaimReport(id, moderatorID int) (Report, error) {
+	return db.updateReport(id, func(report Report, now time.Time) (Report, ReportAction, error) {
+		return report.claim(moderatorID, now)
+	}, nil)
+}
+
+// ResolveReport closes the report with the resolution, logs it and carries it out
+// in the same write: the chirp is hidden or the user suspended only if the report is resolved.
+func (db *DB) ResolveReport(id, moderatorID int, resolution Resolution, note string) (Report, error) {
+	return db.updateReport(id, func(report Report, now time.Time) (Report, ReportAction, error) {
+		return report.resolve(moderatorID, resolution, note, now)
+	}, db.resolutionOps)
+}
+
+// resolutionOps returns the operations carrying out the resolution of the report.
+// Moderators and admins are not suspended, so that they can't take each other down.
+// Callers must hold the write lock.
+func (db *DB) resolutionOps(report Report) ([]walOp, error) {
+	switch report.Resolution {
+	case ResolutionHideChirp:
+		chirp, ok := db.data.Chirps[report.ChirpID]
+		// a chirp deleted meanwhile has nothing left to hide
+		if !ok || chirp.Deleted {
+			return nil, nil
+		}
+		chirp.Hidden = true
+		return []walOp{putOp("chirps", chirp.ID, chirp)}, nil
+	case ResolutionSuspendUser:
+		user, ok := db.data.Users[report.UserID]
+		if !ok {
+			return nil, ErrNotExist
+		}
+		if user.Role != RoleUser {
+			return nil, ErrSuspendStaff
+		}
+		user.Suspended = true
+		return []walOp{putOp("users", user.ID, user)}, nil
+	}
+
+	return nil, nil
+}
+
+// UnhideReport logs the moderator showing again the chirp hidden by the report.
+// Showing the chirp is up to the caller.
+func (db *DB) UnhideReport(id, moderatorID int, note string) (Report, error) {
+	return db.updateReport(id, func(report Report, now time.Time) (Report, ReportAction, error) {
+		return report.unhide(moderatorID, note, now)
+	}, nil)
+}
+
+// updateReport saves the report changed by update together with its log entry
+// and the operations of effect, when not nil, all in one commit
+func (db *DB) updateReport(id int, update func(report Report, now time.Time) (Report, ReportAction, error), effect func(report Report) ([]walOp, error)) (Report, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	report, ok := db.data.Reports[id]
+	if !ok {
+		return Report{}, ErrNotExist
+	}
+
+	report, action, err := update(report, time.Now().UTC())
+	if err != nil {
+		return Report{}, err
+	}
+
+	ops := []walOp{}
+	if effect != nil {
+		ops, err = effect(report)
+		if err != nil {
+			return Report{}, err
+		}
+	}
+
+	actionID, actionSequenceOp := db.nextID("report_actions")
+	action.ID = actionID
+
+	err = db.commit(append(ops, putOp("reports", id, report), actionSequenceOp, putOp("report_actions", actionID, action))...)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// SearchQuery selects a page of the chirps matching a full-text query
+type SearchQuery struct {
+	// Text holds the words to find; words between double quotes must appear as a phrase
+	Text string
+	// AuthorID restricts the results to one author when not zero
+	AuthorID int
+	// After continues from the result following the cursor
+	After *SearchCursor
+	// Limit is the maximum number of results returned, zero for no limit
+	Limit int
+}
+
+// SearchCursor is the position of a result in the ranking.
+// It marks the last result of a page.
+type SearchCursor struct {
+	Score float64 `json:"score"`
+	ID    int     `json:"id"`
+}
+
+// SearchResult is a chirp matching a search with its BM25 score
+type SearchResult struct {
+	Chirp
+	Score float64
+}
+
+// Cursor returns the position of the result in the ranking
+func (result SearchResult) Cursor() SearchCursor {
+	return SearchCursor{Score: result.Score, ID: result.ID}
+}
+
+// before reports whether c ranks before other: higher scores first, then lower IDs
+func (c SearchCursor) before(other SearchCursor) bool {
+	if c.Score != other.Score {
+		return c.Score > other.Score
+	}
+	return c.ID < other.ID
+}
+
+// searchToken is a case-folded word of a text and its position in the text, counted in words
+type searchToken struct {
+	Term     string
+	Position int
+}
+
+// tokenize splits text into case-folded words of letters, marks and digits.
+// Masked words, made of symbols only, produce no token.
+func tokenize(text string) []searchToken {
+	tokens := []searchToken{}
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsMark(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		tokens = append(tokens, searchToken{Term: strings.ToLower(word), Position: i})
+	}
+
+	return tokens
+}
+
+// parsedSearch is a search text split into its terms and phrases
+type parsedSearch struct {
+	// Terms holds every distinct term of the text, phrases included
+	Terms []string
+	// Phrases holds the quoted sequences of more than one term
+	Phrases [][]string
+}
+
+// parseSearch splits a search text into terms and double-quoted phrases
+func parseSearch(text string) parsedSearch {
+	parsed := parsedSearch{}
+	seen := map[string]bool{}
+
+	for i, part := range strings.Split(text, `"`) {
+		terms := []string{}
+		for _, token := range tokenize(part) {
+			terms = append(terms, token.Term)
+			if !seen[token.Term] {
+				seen[token.Term] = true
+				parsed.Terms = append(parsed.Terms, token.Term)
+			}
+		}
+		// odd parts are inside quotes
+		if i%2 == 1 && len(terms) > 1 {
+			parsed.Phrases = append(parsed.Phrases, terms)
+		}
+	}
+
+	return parsed
+}
+
+// searchStats holds the corpus figures BM25 needs
+type searchStats struct {
+	// Documents is the number of indexed chirps and TotalLength the sum of their lengths in terms
+	Documents   int
+	TotalLength int
+	// DocumentFrequency is the number of chirps containing each term of the query
+	DocumentFrequency map[string]int
+}
+
+// rankSearch scores the chirps containing every term and phrase of the search with BM25
+// and returns the page of hits after the cursor, best first.
+// postings maps each term to the positions of the term in the candidate chirps,
+// and lengths holds the length in terms of the candidate chirps.
+func rankSearch(parsed parsedSearch, stats searchStats, postings map[string]map[int][]int, lengths map[int]int, query SearchQuery) []SearchCursor {
+	if len(parsed.Terms) == 0 || stats.Documents == 0 {
+		return []SearchCursor{}
+	}
+	averageLength := float64(stats.TotalLength) / float64(stats.Documents)
+
+	hits := []SearchCursor{}
+	for chirpID := range postings[parsed.Terms[0]] {
+		if !containsSearch(parsed, postings, chirpID) {
+			continue
+		}
+
+		score := 0.0
+		length := float64(lengths[chirpID])
+		for _, term := range parsed.Terms {
+			frequency := float64(len(postings[term][chirpID]))
+			documents := float64(stats.DocumentFrequency[term])
+			idf := math.Log(1 + (float64(stats.Documents)-documents+0.5)/(documents+0.5))
+			score += idf * frequency * (bm25K1 + 1) / (frequency + bm25K1*(1-bm25B+bm25B*length/averageLength))
+		}
+
+		hit := SearchCursor{Score: score, ID: chirpID}
+		if query.After == nil || query.After.before(hit) {
+			hits = append(hits, hit)
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool { return hits[i].before(hits[j]) })
+	if query.Limit > 0 && len(hits) > query.Limit {
+		hits = hits[:query.Limit]
+	}
+
+	return hits
+}
+
+// containsSearch reports whether the chirp contains every term and phrase of the search
+func containsSearch(parsed parsedSearch, postings map[string]map[int][]int, chirpID int) bool {
+	for _, term := range parsed.Terms {
+		if len(postings[term][chirpID]) == 0 {
+			return false
+		}
+	}
+
+	for _, phrase := range parsed.Phrases {
+		found := false
+		for _, start := range postings[phrase[0]][chirpID] {
+			found = true
+			for i, term := range phrase[1:] {
+				if !containsInt(postings[term][chirpID], start+i+1) {
+					found = false
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsInt reports whether the sorted list holds n
+func containsInt(sorted []int, n int) bool {
+	i := sort.SearchInts(sorted, n)
+	return i < len(sorted) && sorted[i] == n
+}
+
+// termPositions groups the positions of the tokens by term
+func termPositions(tokens []searchToken) map[string][]int {
+	positions := map[string][]int{}
+	for _, token := range tokens {
+		positions[token.Term] = append(positions[token.Term], token.Position)
+	}
+
+	return positions
+}
+
+// SearchChirps returns the page of chirps matching the query, best match first
+func (db *DB) SearchChirps(query SearchQuery) ([]SearchResult, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	parsed := parseSearch(query.Text)
+	stats := searchStats{
+		Documents:         len(db.searchLengths),
+		TotalLength:       db.searchTotalLength,
+		DocumentFrequency: map[string]int{},
+	}
+
+	postings := map[string]map[int][]int{}
+	for _, term := range parsed.Terms {
+		stats.DocumentFrequency[term] = len(db.searchPostings[term])
+		postings[term] = map[int][]int{}
+		for chirpID, positions := range db.searchPostings[term] {
+			chirp := db.data.Chirps[chirpID]
+			if chirp.Hidden || (query.AuthorID != 0 && chirp.AuthorID != query.AuthorID) {
+				continue
+			}
+			postings[term][chirpID] = positions
+		}
+	}
+
+	results := []SearchResult{}
+	for _, hit := range rankSearch(parsed, stats, postings, db.searchLengths, query) {
+		results = append(results, SearchResult{
+			Chirp: db.data.Chirps[hit.ID],
+			Score: hit.Score,
+		})
+	}
+
+	return results, nil
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// Session is one login of a user on a device.
+// Its ID is the family ID of the refresh tokens rotated from that login.
+type Session struct {
+	ID         string
+	UserID     int
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	// ExpiresAt follows the expiry of the latest refresh token of the session
+	ExpiresAt time.Time
+	// RevokedAt is set when the session was logged out
+	RevokedAt time.Time
+}
+
+// IsActive reports whether the session can still be used at the time
+func (session Session) IsActive(now time.Time) bool {
+	return session.RevokedAt.IsZero() && now.Before(session.ExpiresAt)
+}
+
+// sortSessions orders sessions by most recent use first
+func sortSessions(sessions []Session) {
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+}
+
+// CreateSession saves a new session together with the first refresh token of its family
+func (db *DB) CreateSession(session Session, token RefreshToken) (Session, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	now := time.Now().UTC()
+	session.CreatedAt = now
+	session.LastUsedAt = now
+	session.ExpiresAt = token.ExpiresAt
+	token.FamilyID = session.ID
+	token.UserID = session.UserID
+	token.CreatedAt = now
+
+	err := db.commit(putOp("sessions", session.ID, session), putOp("refresh_tokens", token.ID, token))
+	if err != nil {
+		return Session{}, err
+	}
+
+	return session, nil
+}
+
+// GetSession returns the session with the ID
+func (db *DB) GetSession(ID string) (Session, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	session, ok := db.data.Sessions[ID]
+	if !ok {
+		return Session{}, ErrNotExist
+	}
+
+	return session, nil
+}
+
+// GetUserSessions returns the active sessions of the user, most recently used first
+func (db *DB) GetUserSessions(userID int) ([]Session, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	now := time.Now().UTC()
+	sessions := []Session{}
+	for _, ID := range db.sessionsByUser[userID] {
+		session := db.data.Sessions[ID]
+		if session.IsActive(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sortSessions(sessions)
+
+	return sessions, nil
+}
+
+// TouchSession records a use of the session at the time
+func (db *DB) TouchSession(ID string, at time.Time) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	session, ok := db.data.Sessions[ID]
+	if !ok {
+		return ErrNotExist
+	}
+	if !at.After(session.LastUsedAt) {
+		return nil
+	}
+	session.LastUsedAt = at
+
+	return db.commit(putOp("sessions", ID, session))
+}
+
+// RevokeSession logs the session out and revokes its refresh tokens
+func (db *DB) RevokeSession(ID string) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	_, ok := db.data.Sessions[ID]
+	if !ok {
+		return ErrNotExist
+	}
+
+	return db.commit(db.revokeSessionOps(ID, time.Now().UTC())...)
+}
+
+// RevokeUserSessions logs out every session of the user
+// and returns how many were still active
+func (db *DB) RevokeUserSessions(userID int) (int, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	now := time.Now().UTC()
+	count := 0
+	ops := []walOp{}
+	for _, ID := range db.sessionsByUser[userID] {
+		if db.data.Sessions[ID].IsActive(now) {
+			ops = append(ops, db.revokeSessionOps(ID, now)...)
+			count++
+		}
+	}
+	if len(ops) == 0 {
+		return 0, nil
+	}
+
+	return count, db.commit(ops...)
+}
+
+// revokeSessionOps returns the operations revoking the session and the tokens of its family.
+// Callers must hold the write lock.
+func (db *DB) revokeSessionOps(ID string, now time.Time) []walOp {
+	ops := []walOp{}
+	session, ok := db.data.Sessions[ID]
+	if ok && session.RevokedAt.IsZero() {
+		session.RevokedAt = now
+		ops = append(ops, putOp("sessions", ID, session))
+	}
+
+	for _, tokenID := range db.refreshTokenFamilies[ID] {
+		token := db.data.RefreshTokens[tokenID]
+		if !token.RevokedAt.IsZero() {
+			continue
+		}
+		token.RevokedAt = now
+		ops = append(ops, putOp("refresh_tokens", tokenID, token))
+	}
+
+	return ops
+}
+
+// DeleteExpiredSessions removes the sessions and the refresh tokens that expired
+// before the time and returns how many sessions were removed
+func (db *DB) DeleteExpiredSessions(before time.Time) (int, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	count := 0
+	ops := []walOp{}
+	for ID, session := range db.data.Sessions {
+		if session.ExpiresAt.Before(before) {
+			ops = append(ops, deleteOp("sessions", ID))
+			count++
+		}
+	}
+	for ID, token := range db.data.RefreshTokens {
+		if token.ExpiresAt.Before(before) {
+			ops = append(ops, deleteOp("refresh_tokens", ID))
+		}
+	}
+	if len(ops) == 0 {
+		return 0, nil
+	}
+
+	return count, db.commit(ops...)
+}
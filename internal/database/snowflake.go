@@ -0,0 +1,67 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Snowflake IDs are 63-bit positive integers made of
+// 41 bits of milliseconds since snowflakeEpoch, 10 bits of node ID and a 12 bit sequence,
+// so they sort by creation time and never collide between nodes.
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxNode      = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+// snowflakeEpoch is 2024-01-01T00:00:00Z
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// snowflake generates time-ordered 64-bit IDs
+type snowflake struct {
+	mux      sync.Mutex
+	node     int64
+	lastMs   int64
+	sequence int64
+	now      func() time.Time
+}
+
+// newSnowflake returns a generator for the given node ID
+func newSnowflake(node int) (*snowflake, error) {
+	if node < 0 || node > snowflakeMaxNode {
+		return nil, fmt.Errorf("snowflake node must be between 0 and %d", snowflakeMaxNode)
+	}
+
+	return &snowflake{
+		node: int64(node),
+		now:  time.Now,
+	}, nil
+}
+
+// Next returns a new ID, greater than every ID returned before
+func (s *snowflake) Next() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	ms := s.now().Sub(snowflakeEpoch).Milliseconds()
+	// never go back in time, even if the wall clock does
+	if ms < s.lastMs {
+		ms = s.lastMs
+	}
+
+	if ms == s.lastMs {
+		s.sequence++
+		if s.sequence > snowflakeMaxSequence {
+			// sequence exhausted for this millisecond, borrow the next one
+			ms++
+			s.sequence = 0
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.lastMs = ms
+
+	return int(ms<<(snowflakeNodeBits+snowflakeSequenceBits) | s.node<<snowflakeSequenceBits | s.sequence)
+}
@@ -0,0 +1,287 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteDB struct {
+	conn      *sql.DB
+	snowflake *snowflake
+}
+
+// sqliteMigrations holds the schema changes applied in order.
+// The index of the last applied migration plus one is stored in PRAGMA user_version.
+var sqliteMigrations = []string{
+	`CREATE TABLE chirps (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		body      TEXT    NOT NULL,
+		author_id INTEGER NOT NULL
+	);
+	CREATE INDEX chirps_author_id ON chirps (author_id);
+	CREATE TABLE users (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		email         TEXT    NOT NULL UNIQUE,
+		password      TEXT    NOT NULL,
+		is_chirpy_red INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE revoked_tokens (
+		id          TEXT     PRIMARY KEY,
+		revoke_time DATETIME NOT NULL
+	);`,
+	`CREATE INDEX users_email_nocase ON users (email COLLATE NOCASE);`,
+	// chirp times are unix nanoseconds, older chirps get the migration time
+	`ALTER TABLE chirps ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE chirps ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+	UPDATE chirps SET
+		created_at = CAST(unixepoch('subsec') * 1000000000 AS INTEGER),
+		updated_at = CAST(unixepoch('subsec') * 1000000000 AS INTEGER);
+	CREATE INDEX chirps_created_at ON chirps (created_at, id);
+	CREATE INDEX chirps_updated_at ON chirps (updated_at, id);`,
+	`CREATE TABLE follows (
+		follower_id INTEGER NOT NULL,
+		followee_id INTEGER NOT NULL,
+		created_at  INTEGER NOT NULL,
+		PRIMARY KEY (follower_id, followee_id)
+	);
+	CREATE INDEX follows_followee ON follows (followee_id, follower_id);`,
+	`ALTER TABLE chirps ADD COLUMN in_reply_to INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE chirps ADD COLUMN deleted INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX chirps_in_reply_to ON chirps (in_reply_to, id);`,
+	`CREATE TABLE likes (
+		user_id    INTEGER NOT NULL,
+		chirp_id   INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (user_id, chirp_id)
+	);
+	CREATE INDEX likes_chirp_id ON likes (chirp_id);
+	ALTER TABLE chirps ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX chirps_like_count ON chirps (like_count, id);`,
+	`ALTER TABLE chirps ADD COLUMN rechirp_of INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE chirps ADD COLUMN rechirp_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE chirps ADD COLUMN quote_count INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX chirps_rechirp_of ON chirps (rechirp_of, author_id);`,
+	`ALTER TABLE chirps ADD COLUMN hashtags TEXT NOT NULL DEFAULT '';
+	CREATE TABLE chirp_hashtags (
+		tag        TEXT NOT NULL,
+		chirp_id   INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (tag, chirp_id)
+	);
+	CREATE INDEX chirp_hashtags_created_at ON chirp_hashtags (created_at);
+	CREATE INDEX chirp_hashtags_chirp_id ON chirp_hashtags (chirp_id);`,
+	`ALTER TABLE users ADD COLUMN handle TEXT NOT NULL DEFAULT '';
+	CREATE UNIQUE INDEX users_handle_nocase ON users (handle COLLATE NOCASE) WHERE handle != '';
+	ALTER TABLE chirps ADD COLUMN mentions TEXT NOT NULL DEFAULT '[]';
+	CREATE TABLE chirp_mentions (
+		user_id  INTEGER NOT NULL,
+		chirp_id INTEGER NOT NULL,
+		PRIMARY KEY (user_id, chirp_id)
+	);
+	CREATE INDEX chirp_mentions_chirp_id ON chirp_mentions (chirp_id);`,
+	`CREATE TABLE search_postings (
+		term      TEXT    NOT NULL,
+		chirp_id  INTEGER NOT NULL,
+		positions TEXT    NOT NULL,
+		PRIMARY KEY (term, chirp_id)
+	);
+	CREATE INDEX search_postings_chirp_id ON search_postings (chirp_id);
+	CREATE TABLE search_docs (
+		chirp_id INTEGER PRIMARY KEY,
+		length   INTEGER NOT NULL
+	);`,
+	`ALTER TABLE chirps ADD COLUMN flagged INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE users ADD COLUMN suspended INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE reports (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		reporter_id INTEGER NOT NULL,
+		chirp_id    INTEGER NOT NULL,
+		user_id     INTEGER NOT NULL,
+		reason      TEXT    NOT NULL,
+		details     TEXT    NOT NULL,
+		status      TEXT    NOT NULL,
+		claimed_by  INTEGER NOT NULL DEFAULT 0,
+		resolution  TEXT    NOT NULL DEFAULT '',
+		created_at  INTEGER NOT NULL,
+		updated_at  INTEGER NOT NULL
+	);
+	CREATE INDEX reports_status ON reports (status, id);
+	CREATE TABLE report_actions (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		report_id  INTEGER NOT NULL,
+		actor_id   INTEGER NOT NULL,
+		action     TEXT    NOT NULL,
+		note       TEXT    NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX report_actions_report_id ON report_actions (report_id, id);`,
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';`,
+	`DROP TABLE revoked_tokens;
+	CREATE TABLE refresh_tokens (
+		id         TEXT    PRIMARY KEY,
+		family_id  TEXT    NOT NULL,
+		user_id    INTEGER NOT NULL,
+		used_at    INTEGER NOT NULL DEFAULT 0,
+		revoked_at INTEGER NOT NULL DEFAULT 0,
+		expires_at INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX refresh_tokens_family_id ON refresh_tokens (family_id);
+	CREATE INDEX refresh_tokens_expires_at ON refresh_tokens (expires_at);`,
+	// every refresh token family already handed out becomes a session
+	`CREATE TABLE sessions (
+		id           TEXT    PRIMARY KEY,
+		user_id      INTEGER NOT NULL,
+		user_agent   TEXT    NOT NULL,
+		ip           TEXT    NOT NULL,
+		created_at   INTEGER NOT NULL,
+		last_used_at INTEGER NOT NULL,
+		expires_at   INTEGER NOT NULL,
+		revoked_at   INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX sessions_user_id ON sessions (user_id, last_used_at);
+	CREATE INDEX sessions_expires_at ON sessions (expires_at);
+	INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at)
+		SELECT family_id, user_id, '', '', MIN(created_at), MAX(created_at), MAX(expires_at), MAX(revoked_at)
+		FROM refresh_tokens GROUP BY family_id;`,
+	`CREATE TABLE password_resets (
+		token_hash TEXT    PRIMARY KEY,
+		user_id    INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX password_resets_user_id ON password_resets (user_id);
+	CREATE INDEX password_resets_expires_at ON password_resets (expires_at);`,
+	`ALTER TABLE users ADD COLUMN verified INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE email_verifications (
+		token_hash TEXT    PRIMARY KEY,
+		user_id    INTEGER NOT NULL,
+		email      TEXT    NOT NULL,
+		expires_at INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX email_verifications_user_id ON email_verifications (user_id);
+	CREATE INDEX email_verifications_expires_at ON email_verifications (expires_at);`,
+	`CREATE TABLE totp (
+		user_id    INTEGER PRIMARY KEY,
+		secret     TEXT    NOT NULL,
+		enabled    INTEGER NOT NULL DEFAULT 0,
+		last_step  INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		enabled_at INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE recovery_codes (
+		code_hash TEXT    PRIMARY KEY,
+		user_id   INTEGER NOT NULL
+	);
+	CREATE INDEX recovery_codes_user_id ON recovery_codes (user_id);`,
+	`ALTER TABLE chirps ADD COLUMN hidden INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// sqliteBackfills fill the tables created by a migration from existing rows,
+// in the transaction of the migration. They are keyed by migration number.
+var sqliteBackfills = map[int]func(tx *sql.Tx) error{
+	10: backfillSearchIndex,
+}
+
+// NewSQLiteDB opens the SQLite database at path
+// and creates or upgrades its schema if needed
+func NewSQLiteDB(path string, opts Options) (*SQLiteDB, error) {
+	generator, err := newIDGenerator(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows one writer at a time
+	conn.SetMaxOpenConns(1)
+
+	db := &SQLiteDB{
+		conn:      conn,
+		snowflake: generator,
+	}
+
+	err = db.migrate()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// migrate applies the pending schema migrations
+func (db *SQLiteDB) migrate() error {
+	var version int
+	err := db.conn.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := db.conn.Begin()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(sqliteMigrations[i])
+		if err == nil && sqliteBackfills[i+1] != nil {
+			err = sqliteBackfills[i+1](tx)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlite migration %d: %w", i+1, err)
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nextID returns the ID to insert for a new record.
+// Without snowflake IDs it returns nil and AUTOINCREMENT allocates the ID,
+// which never reuses the IDs of deleted rows.
+func (db *SQLiteDB) nextID() any {
+	if db.snowflake == nil {
+		return nil
+	}
+
+	return db.snowflake.Next()
+}
+
+// toUnixNano converts a time for storage in an INTEGER column
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano converts a time stored by toUnixNano back
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
+
+// Close closes the database connection
+func (db *SQLiteDB) Close() error {
+	return db.conn.Close()
+}
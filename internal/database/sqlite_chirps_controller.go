@@ -0,0 +1,505 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const chirpColumns = "id, body, author_id, in_reply_to, deleted, like_count, rechirp_of, rechirp_count, quote_count, hashtags, mentions, flagged, hidden, created_at, updated_at"
+
+// CreateChirp creates a new chirp and saves it to the database.
+// A reply to, or a reshare of, a chirp that doesn't exist, was deleted or is hidden returns ErrNotExist.
+// Rechirping a rechirp reshares its original, and rechirping a chirp twice
+// returns the existing rechirp.
+func (db *SQLiteDB) CreateChirp(params CreateChirpParams) (Chirp, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	if params.InReplyTo != 0 {
+		var removed bool
+		err := tx.QueryRow("SELECT deleted = 1 OR hidden = 1 FROM chirps WHERE id = ?", params.InReplyTo).Scan(&removed)
+		if errors.Is(err, sql.ErrNoRows) || removed {
+			return Chirp{}, ErrNotExist
+		}
+		if err != nil {
+			return Chirp{}, err
+		}
+	}
+
+	if params.RechirpOf != 0 {
+		original, err := getChirpTx(tx, params.RechirpOf)
+		if err != nil {
+			return Chirp{}, err
+		}
+		if params.Body == "" && original.IsRechirp() {
+			original, err = getChirpTx(tx, original.RechirpOf)
+			if err != nil {
+				return Chirp{}, err
+			}
+		}
+		if original.Hidden {
+			return Chirp{}, ErrNotExist
+		}
+		params.RechirpOf = original.ID
+
+		countColumn := "quote_count"
+		if params.Body == "" {
+			rows, err := tx.Query("SELECT "+chirpColumns+" FROM chirps WHERE rechirp_of = ? AND author_id = ? AND body = '' AND deleted = 0",
+				original.ID, params.AuthorID)
+			if err != nil {
+				return Chirp{}, err
+			}
+			existing, err := scanChirps(rows)
+			if err != nil {
+				return Chirp{}, err
+			}
+			if len(existing) > 0 {
+				return existing[0], nil
+			}
+			countColumn = "rechirp_count"
+		}
+
+		_, err = tx.Exec("UPDATE chirps SET "+countColumn+" = "+countColumn+" + 1 WHERE id = ?", original.ID)
+		if err != nil {
+			return Chirp{}, err
+		}
+	}
+
+	mentions, err := json.Marshal(append([]Mention{}, params.Mentions...))
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	now := time.Now().UTC()
+	res, err := tx.Exec("INSERT INTO chirps (id, body, author_id, in_reply_to, rechirp_of, hashtags, mentions, flagged, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		db.nextID(), params.Body, params.AuthorID, params.InReplyTo, params.RechirpOf, strings.Join(params.Hashtags, " "), string(mentions), params.Flagged, toUnixNano(now), toUnixNano(now))
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	for _, tag := range params.Hashtags {
+		_, err = tx.Exec("INSERT INTO chirp_hashtags (tag, chirp_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING", tag, id, toUnixNano(now))
+		if err != nil {
+			return Chirp{}, err
+		}
+	}
+
+	for _, userID := range (Chirp{Mentions: params.Mentions}).MentionedUserIDs() {
+		_, err = tx.Exec("INSERT INTO chirp_mentions (user_id, chirp_id) VALUES (?, ?)", userID, id)
+		if err != nil {
+			return Chirp{}, err
+		}
+	}
+
+	err = indexChirpText(tx, int(id), params.Body)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return Chirp{
+		ID:        int(id),
+		Body:      params.Body,
+		AuthorID:  params.AuthorID,
+		InReplyTo: params.InReplyTo,
+		RechirpOf: params.RechirpOf,
+		Hashtags:  params.Hashtags,
+		Mentions:  params.Mentions,
+		Flagged:   params.Flagged,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// GetChirps returns all chirps in the database
+func (db *SQLiteDB) GetChirps() ([]Chirp, error) {
+	rows, err := db.conn.Query("SELECT " + chirpColumns + " FROM chirps")
+	if err != nil {
+		return nil, err
+	}
+
+	return scanChirps(rows)
+}
+
+// GetChirpsById returns the chirp with the correspondent ID
+func (db *SQLiteDB) GetChirpsById(id int) (Chirp, error) {
+	rows, err := db.conn.Query("SELECT "+chirpColumns+" FROM chirps WHERE id = ?", id)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	chirps, err := scanChirps(rows)
+	if err != nil {
+		return Chirp{}, err
+	}
+	if len(chirps) == 0 {
+		return Chirp{}, ErrNotExist
+	}
+
+	return chirps[0], nil
+}
+
+// GetChirpsByAuthorId returns the chirp with the correspondent AuthorID
+func (db *SQLiteDB) GetChirpsByAuthorId(authorID int) ([]Chirp, error) {
+	rows, err := db.conn.Query("SELECT "+chirpColumns+" FROM chirps WHERE author_id = ?", authorID)
+	if err != nil {
+		return []Chirp{}, err
+	}
+
+	return scanChirps(rows)
+}
+
+// chirpSortColumns maps the sort orders to their ORDER BY columns
+var chirpSortColumns = map[ChirpSort]string{
+	ChirpSortID:      "id",
+	ChirpSortCreated: "created_at, id",
+	ChirpSortUpdated: "updated_at, id",
+	ChirpSortLikes:   "like_count, id",
+}
+
+// GetChirpsPage returns the page of chirps selected by the query
+func (db *SQLiteDB) GetChirpsPage(query ChirpQuery) ([]Chirp, error) {
+	where := []string{"deleted = 0", "hidden = 0"}
+	args := []any{}
+
+	if query.AuthorID != 0 {
+		where = append(where, "author_id = ?")
+		args = append(args, query.AuthorID)
+	}
+	if query.TimelineOf != 0 {
+		where = append(where, "(author_id = ? OR author_id IN (SELECT followee_id FROM follows WHERE follower_id = ?))")
+		args = append(args, query.TimelineOf, query.TimelineOf)
+	}
+	if query.Hashtag != "" {
+		where = append(where, "id IN (SELECT chirp_id FROM chirp_hashtags WHERE tag = ?)")
+		args = append(args, query.Hashtag)
+	}
+	if query.MentionOf != 0 {
+		where = append(where, "id IN (SELECT chirp_id FROM chirp_mentions WHERE user_id = ?)")
+		args = append(args, query.MentionOf)
+	}
+	if !query.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, toUnixNano(query.Since))
+	}
+	if !query.Until.IsZero() {
+		where = append(where, "created_at <= ?")
+		args = append(args, toUnixNano(query.Until))
+	}
+
+	columns := chirpSortColumns[query.SortBy]
+	comparison, order := ">", " ASC"
+	if query.Descending {
+		comparison, order = "<", " DESC"
+	}
+
+	if query.After != nil {
+		switch query.SortBy {
+		case ChirpSortID:
+			where = append(where, "id "+comparison+" ?")
+			args = append(args, query.After.ID)
+		case ChirpSortLikes:
+			where = append(where, "("+columns+") "+comparison+" (?, ?)")
+			args = append(args, query.After.Count, query.After.ID)
+		default:
+			where = append(where, "("+columns+") "+comparison+" (?, ?)")
+			args = append(args, toUnixNano(query.After.Time), query.After.ID)
+		}
+	}
+
+	stmt := "SELECT " + chirpColumns + " FROM chirps WHERE " + strings.Join(where, " AND ")
+	stmt += " ORDER BY " + strings.ReplaceAll(columns, ",", order+",") + order
+	if query.Limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	rows, err := db.conn.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanChirps(rows)
+}
+
+// GetChirpAncestors returns the chain of chirps the chirp replies to, root first
+func (db *SQLiteDB) GetChirpAncestors(id int) ([]Chirp, error) {
+	_, err := db.GetChirpsById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(`WITH RECURSIVE ancestors(id, depth) AS (
+			SELECT in_reply_to, 1 FROM chirps WHERE id = ? AND in_reply_to != 0
+			UNION ALL
+			SELECT c.in_reply_to, a.depth + 1 FROM chirps c JOIN ancestors a ON c.id = a.id WHERE c.in_reply_to != 0
+		)
+		SELECT `+prefixColumns("c", chirpColumns)+` FROM ancestors a JOIN chirps c ON c.id = a.id ORDER BY a.depth DESC`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanChirps(rows)
+}
+
+// GetChirpDescendants returns a page of the replies below the chirp, in depth-first order.
+// Replies are ordered by their path of zero-padded IDs, which sorts depth first.
+func (db *SQLiteDB) GetChirpDescendants(id int, query ThreadQuery) ([]ThreadChirp, error) {
+	_, err := db.GetChirpsById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	after := ""
+	for i, pathID := range query.After {
+		if i > 0 {
+			after += "/"
+		}
+		after += fmt.Sprintf("%020d", pathID)
+	}
+
+	stmt := `WITH RECURSIVE tree(id, path, sort_path) AS (
+			SELECT id, CAST(id AS TEXT), printf('%020d', id) FROM chirps WHERE in_reply_to = ?
+			UNION ALL
+			SELECT c.id, t.path || ',' || c.id, t.sort_path || '/' || printf('%020d', c.id)
+			FROM chirps c JOIN tree t ON c.in_reply_to = t.id
+		)
+		SELECT ` + prefixColumns("c", chirpColumns) + `, t.path FROM tree t JOIN chirps c ON c.id = t.id
+		WHERE t.sort_path > ? ORDER BY t.sort_path`
+	args := []any{id, after}
+	if query.Limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	rows, err := db.conn.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	descendants := []ThreadChirp{}
+	for rows.Next() {
+		var path string
+		chirp, err := scanChirp(rows, &path)
+		if err != nil {
+			return nil, err
+		}
+
+		threadChirp := ThreadChirp{Chirp: chirp}
+		for _, pathID := range strings.Split(path, ",") {
+			ID, err := strconv.Atoi(pathID)
+			if err != nil {
+				return nil, err
+			}
+			threadChirp.Path = append(threadChirp.Path, ID)
+		}
+		descendants = append(descendants, threadChirp)
+	}
+
+	return descendants, rows.Err()
+}
+
+// DeleteChirp deletes the chirp.
+// A chirp with replies becomes a tombstone instead, and tombstones
+// left without replies are removed along with their last reply.
+func (db *SQLiteDB) DeleteChirp(chirp Chirp) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	chirp, err = getChirpTx(tx, chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	// remove the chirp from the counts of the chirp it reshares
+	if chirp.RechirpOf != 0 {
+		countColumn := "quote_count"
+		if chirp.IsRechirp() {
+			countColumn = "rechirp_count"
+		}
+		_, err = tx.Exec("UPDATE chirps SET "+countColumn+" = "+countColumn+" - 1 WHERE id = ?", chirp.RechirpOf)
+		if err != nil {
+			return err
+		}
+	}
+
+	var hasReplies bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM chirps WHERE in_reply_to = ?)", chirp.ID).Scan(&hasReplies)
+	if err != nil {
+		return err
+	}
+
+	if hasReplies {
+		_, err = tx.Exec("UPDATE chirps SET deleted = 1, body = '', hashtags = '', mentions = '[]', updated_at = ? WHERE id = ?", toUnixNano(time.Now().UTC()), chirp.ID)
+		if err != nil {
+			return err
+		}
+		err = deleteChirpReferences(tx, chirp.ID)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	parentID := chirp.InReplyTo
+	err = deleteChirpRow(tx, chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	// remove the tombstones left without replies
+	for parentID != 0 {
+		var removable bool
+		grandparentID := 0
+		err = tx.QueryRow(`SELECT in_reply_to, deleted = 1 AND NOT EXISTS (SELECT 1 FROM chirps WHERE in_reply_to = ?)
+			FROM chirps WHERE id = ?`, parentID, parentID).Scan(&grandparentID, &removable)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !removable) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		err = deleteChirpRow(tx, parentID)
+		if err != nil {
+			return err
+		}
+		parentID = grandparentID
+	}
+
+	return tx.Commit()
+}
+
+// SetChirpHidden hides the chirp, or shows it again.
+// Chirps that don't exist or were deleted return ErrNotExist.
+func (db *SQLiteDB) SetChirpHidden(id int, hidden bool) (Chirp, error) {
+	res, err := db.conn.Exec("UPDATE chirps SET hidden = ? WHERE id = ? AND deleted = 0", hidden, id)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return Chirp{}, err
+	}
+	if count == 0 {
+		return Chirp{}, ErrNotExist
+	}
+
+	return db.GetChirpsById(id)
+}
+
+// getChirpTx returns the chirp with the given ID inside a transaction.
+// Chirps that don't exist or were deleted return ErrNotExist.
+func getChirpTx(tx *sql.Tx, id int) (Chirp, error) {
+	rows, err := tx.Query("SELECT "+chirpColumns+" FROM chirps WHERE id = ? AND deleted = 0", id)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	chirps, err := scanChirps(rows)
+	if err != nil {
+		return Chirp{}, err
+	}
+	if len(chirps) == 0 {
+		return Chirp{}, ErrNotExist
+	}
+
+	return chirps[0], nil
+}
+
+// deleteChirpReferences removes the hashtags, mentions and words of a chirp from their indexes
+func deleteChirpReferences(tx *sql.Tx, chirpID int) error {
+	for _, table := range []string{"chirp_hashtags", "chirp_mentions", "search_postings", "search_docs"} {
+		_, err := tx.Exec("DELETE FROM "+table+" WHERE chirp_id = ?", chirpID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteChirpRow removes a chirp, its likes and its index entries
+func deleteChirpRow(tx *sql.Tx, chirpID int) error {
+	_, err := tx.Exec("DELETE FROM likes WHERE chirp_id = ?", chirpID)
+	if err != nil {
+		return err
+	}
+
+	err = deleteChirpReferences(tx, chirpID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM chirps WHERE id = ?", chirpID)
+	return err
+}
+
+// scanChirps reads all the chirps from rows and closes them
+func scanChirps(rows *sql.Rows) ([]Chirp, error) {
+	defer rows.Close()
+
+	chirps := []Chirp{}
+	for rows.Next() {
+		chirp, err := scanChirp(rows)
+		if err != nil {
+			return nil, err
+		}
+		chirps = append(chirps, chirp)
+	}
+
+	return chirps, rows.Err()
+}
+
+// scanChirp reads the chirpColumns of the current row, followed by the extra columns
+func scanChirp(rows *sql.Rows, extra ...any) (Chirp, error) {
+	chirp := Chirp{}
+	var hashtags, mentions string
+	var createdAt, updatedAt int64
+	dest := append([]any{&chirp.ID, &chirp.Body, &chirp.AuthorID, &chirp.InReplyTo, &chirp.Deleted, &chirp.LikeCount,
+		&chirp.RechirpOf, &chirp.RechirpCount, &chirp.QuoteCount, &hashtags, &mentions, &chirp.Flagged, &chirp.Hidden, &createdAt, &updatedAt}, extra...)
+	err := rows.Scan(dest...)
+	if err != nil {
+		return Chirp{}, err
+	}
+	chirp.Hashtags = strings.Fields(hashtags)
+	err = json.Unmarshal([]byte(mentions), &chirp.Mentions)
+	if err != nil {
+		return Chirp{}, err
+	}
+	chirp.CreatedAt = fromUnixNano(createdAt)
+	chirp.UpdatedAt = fromUnixNano(updatedAt)
+
+	return chirp, nil
+}
+
+// prefixColumns qualifies a comma separated column list with a table alias
+func prefixColumns(alias, columns string) string {
+	names := strings.Split(columns, ", ")
+	for i, name := range names {
+		names[i] = alias + "." + name
+	}
+	return strings.Join(names, ", ")
+}
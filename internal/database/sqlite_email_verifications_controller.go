@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CreateEmailVerification saves a new verification token, replacing the previous ones of the user
+func (db *SQLiteDB) CreateEmailVerification(verification EmailVerification) (EmailVerification, error) {
+	_, err := db.GetUserByID(verification.UserID)
+	if err != nil {
+		return EmailVerification{}, err
+	}
+	verification.CreatedAt = time.Now().UTC()
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return EmailVerification{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM email_verifications WHERE user_id = ?", verification.UserID)
+	if err != nil {
+		return EmailVerification{}, err
+	}
+
+	_, err = tx.Exec("INSERT INTO email_verifications (token_hash, user_id, email, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		verification.TokenHash, verification.UserID, verification.Email, toUnixNano(verification.ExpiresAt), toUnixNano(verification.CreatedAt))
+	if err != nil {
+		return EmailVerification{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return EmailVerification{}, err
+	}
+
+	return verification, nil
+}
+
+// VerifyEmail marks the email of the token as verified, switching the user to it
+// when it was a pending change, and uses the token up
+func (db *SQLiteDB) VerifyEmail(tokenHash string) (User, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var email string
+	var expiresAt int64
+	err = tx.QueryRow("SELECT user_id, email, expires_at FROM email_verifications WHERE token_hash = ?", tokenHash).Scan(&userID, &email, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotExist
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if !time.Now().UTC().Before(fromUnixNano(expiresAt)) {
+		return User{}, ErrTokenExpired
+	}
+
+	var ownerID int
+	err = tx.QueryRow("SELECT id FROM users WHERE email = ? COLLATE NOCASE AND id != ?", email, userID).Scan(&ownerID)
+	if err == nil {
+		return User{}, ErrEmailTaken
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return User{}, err
+	}
+
+	res, err := tx.Exec("UPDATE users SET email = ?, verified = 1 WHERE id = ?", email, userID)
+	if err != nil {
+		return User{}, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return User{}, err
+	}
+	if count == 0 {
+		return User{}, ErrNotExist
+	}
+
+	_, err = tx.Exec("DELETE FROM email_verifications WHERE user_id = ?", userID)
+	if err != nil {
+		return User{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return User{}, err
+	}
+
+	return db.GetUserByID(userID)
+}
+
+// DeleteExpiredEmailVerifications removes the verification tokens that expired before the time
+// and returns how many were removed
+func (db *SQLiteDB) DeleteExpiredEmailVerifications(before time.Time) (int, error) {
+	res, err := db.conn.Exec("DELETE FROM email_verifications WHERE expires_at < ?", toUnixNano(before))
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := res.RowsAffected()
+	return int(count), err
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// FollowUser makes the follower follow the followee.
+// Following a user twice keeps the original follow.
+func (db *SQLiteDB) FollowUser(followerID, followeeID int) (Follow, error) {
+	_, err := db.conn.Exec("INSERT INTO follows (follower_id, followee_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		followerID, followeeID, toUnixNano(time.Now().UTC()))
+	if err != nil {
+		return Follow{}, err
+	}
+
+	follow := Follow{}
+	var createdAt int64
+	err = db.conn.QueryRow("SELECT follower_id, followee_id, created_at FROM follows WHERE follower_id = ? AND followee_id = ?", followerID, followeeID).
+		Scan(&follow.FollowerID, &follow.FolloweeID, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Follow{}, ErrNotExist
+	}
+	if err != nil {
+		return Follow{}, err
+	}
+	follow.CreatedAt = fromUnixNano(createdAt)
+
+	return follow, nil
+}
+
+// UnfollowUser removes the follow between the follower and the followee
+func (db *SQLiteDB) UnfollowUser(followerID, followeeID int) error {
+	res, err := db.conn.Exec("DELETE FROM follows WHERE follower_id = ? AND followee_id = ?", followerID, followeeID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotExist
+	}
+
+	return nil
+}
+
+// GetFollowers returns a page of the follows pointing to the user, ordered by follower ID
+func (db *SQLiteDB) GetFollowers(userID int, query FollowQuery) ([]Follow, error) {
+	return db.queryFollows("followee_id", "follower_id", userID, query)
+}
+
+// GetFollowing returns a page of the follows made by the user, ordered by followee ID
+func (db *SQLiteDB) GetFollowing(userID int, query FollowQuery) ([]Follow, error) {
+	return db.queryFollows("follower_id", "followee_id", userID, query)
+}
+
+// queryFollows returns the follows where userColumn is userID, paged on listedColumn
+func (db *SQLiteDB) queryFollows(userColumn, listedColumn string, userID int, query FollowQuery) ([]Follow, error) {
+	stmt := "SELECT follower_id, followee_id, created_at FROM follows WHERE " + userColumn + " = ? AND " + listedColumn + " > ? ORDER BY " + listedColumn
+	args := []any{userID, query.AfterID}
+	if query.Limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	rows, err := db.conn.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	follows := []Follow{}
+	for rows.Next() {
+		follow := Follow{}
+		var createdAt int64
+		err := rows.Scan(&follow.FollowerID, &follow.FolloweeID, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		follow.CreatedAt = fromUnixNano(createdAt)
+		follows = append(follows, follow)
+	}
+
+	return follows, rows.Err()
+}
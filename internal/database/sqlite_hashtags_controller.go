@@ -0,0 +1,31 @@
+package database
+
+import "time"
+
+// GetTrendingHashtags returns the hashtags of the chirps created in the query window,
+// ranked by time-decayed usage
+func (db *SQLiteDB) GetTrendingHashtags(query TrendingQuery) ([]TrendingHashtag, error) {
+	rows, err := db.conn.Query(`SELECT tag, created_at FROM chirp_hashtags WHERE created_at BETWEEN ? AND ?
+		AND chirp_id NOT IN (SELECT id FROM chirps WHERE hidden = 1)`,
+		toUnixNano(query.Since), toUnixNano(query.Until))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uses := map[string][]time.Time{}
+	for rows.Next() {
+		var tag string
+		var createdAt int64
+		err := rows.Scan(&tag, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		uses[tag] = append(uses[tag], fromUnixNano(createdAt))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rankHashtags(uses, query), nil
+}
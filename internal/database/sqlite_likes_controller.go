@@ -0,0 +1,93 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// LikeChirp records that the user likes the chirp and returns the chirp with its new count.
+// Liking a chirp twice keeps a single like.
+func (db *SQLiteDB) LikeChirp(userID, chirpID int) (Chirp, error) {
+	return db.updateLike(chirpID, 1, "INSERT INTO likes (user_id, chirp_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		userID, chirpID, toUnixNano(time.Now().UTC()))
+}
+
+// UnlikeChirp removes the like of the user from the chirp and returns the chirp with its new count
+func (db *SQLiteDB) UnlikeChirp(userID, chirpID int) (Chirp, error) {
+	return db.updateLike(chirpID, -1, "DELETE FROM likes WHERE user_id = ? AND chirp_id = ?", userID, chirpID)
+}
+
+// updateLike runs the like statement and, when it changed a row,
+// moves the like count of the chirp by delta
+func (db *SQLiteDB) updateLike(chirpID, delta int, stmt string, args ...any) (Chirp, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	var removed bool
+	err = tx.QueryRow("SELECT deleted = 1 OR hidden = 1 FROM chirps WHERE id = ?", chirpID).Scan(&removed)
+	if errors.Is(err, sql.ErrNoRows) || removed {
+		return Chirp{}, ErrNotExist
+	}
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	res, err := tx.Exec(stmt, args...)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return Chirp{}, err
+	}
+	if count > 0 {
+		_, err = tx.Exec("UPDATE chirps SET like_count = like_count + ? WHERE id = ?", delta, chirpID)
+		if err != nil {
+			return Chirp{}, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return db.GetChirpsById(chirpID)
+}
+
+// GetLikedChirps returns which of the chirps the user likes
+func (db *SQLiteDB) GetLikedChirps(userID int, chirpIDs []int) (map[int]bool, error) {
+	liked := map[int]bool{}
+	if len(chirpIDs) == 0 {
+		return liked, nil
+	}
+
+	args := []any{userID}
+	for _, chirpID := range chirpIDs {
+		args = append(args, chirpID)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(chirpIDs)), ", ")
+
+	rows, err := db.conn.Query("SELECT chirp_id FROM likes WHERE user_id = ? AND chirp_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chirpID int
+		err := rows.Scan(&chirpID)
+		if err != nil {
+			return nil, err
+		}
+		liked[chirpID] = true
+	}
+
+	return liked, rows.Err()
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CreatePasswordReset saves a new password reset token
+func (db *SQLiteDB) CreatePasswordReset(reset PasswordReset) (PasswordReset, error) {
+	_, err := db.GetUserByID(reset.UserID)
+	if err != nil {
+		return PasswordReset{}, err
+	}
+	reset.CreatedAt = time.Now().UTC()
+
+	_, err = db.conn.Exec("INSERT INTO password_resets (token_hash, user_id, expires_at, created_at) VALUES (?, ?, ?, ?)",
+		reset.TokenHash, reset.UserID, toUnixNano(reset.ExpiresAt), toUnixNano(reset.CreatedAt))
+	if err != nil {
+		return PasswordReset{}, err
+	}
+
+	return reset, nil
+}
+
+// ResetPassword sets the password of the user of the token, then deletes
+// every reset token of the user so that none of them can be used again
+func (db *SQLiteDB) ResetPassword(tokenHash, password string) (User, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var expiresAt int64
+	err = tx.QueryRow("SELECT user_id, expires_at FROM password_resets WHERE token_hash = ?", tokenHash).Scan(&userID, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotExist
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if !time.Now().UTC().Before(fromUnixNano(expiresAt)) {
+		return User{}, ErrTokenExpired
+	}
+
+	res, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", password, userID)
+	if err != nil {
+		return User{}, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return User{}, err
+	}
+	if count == 0 {
+		return User{}, ErrNotExist
+	}
+
+	_, err = tx.Exec("DELETE FROM password_resets WHERE user_id = ?", userID)
+	if err != nil {
+		return User{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return User{}, err
+	}
+
+	return db.GetUserByID(userID)
+}
+
+// DeleteExpiredPasswordResets removes the reset tokens that expired before the time
+// and returns how many were removed
+func (db *SQLiteDB) DeleteExpiredPasswordResets(before time.Time) (int, error) {
+	res, err := db.conn.Exec("DELETE FROM password_resets WHERE expires_at < ?", toUnixNano(before))
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := res.RowsAffected()
+	return int(count), err
+}
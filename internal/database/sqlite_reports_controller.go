@@ -0,0 +1,234 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const reportColumns = "id, reporter_id, chirp_id, user_id, reason, details, status, claimed_by, resolution, created_at, updated_at"
+
+// CreateReport files a new open report and logs it
+func (db *SQLiteDB) CreateReport(params CreateReportParams) (Report, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	res, err := tx.Exec("INSERT INTO reports (id, reporter_id, chirp_id, user_id, reason, details, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		db.nextID(), params.ReporterID, params.ChirpID, params.UserID, params.Reason, params.Details, ReportOpen, toUnixNano(now), toUnixNano(now))
+	if err != nil {
+		return Report{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Report{}, err
+	}
+
+	err = db.insertReportAction(tx, ReportAction{
+		ReportID:  int(id),
+		ActorID:   params.ReporterID,
+		Action:    ReportActionReport,
+		Note:      params.Details,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Report{}, err
+	}
+
+	return Report{
+		ID:         int(id),
+		ReporterID: params.ReporterID,
+		ChirpID:    params.ChirpID,
+		UserID:     params.UserID,
+		Reason:     params.Reason,
+		Details:    params.Details,
+		Status:     ReportOpen,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}, nil
+}
+
+// GetReport returns the report with the corresponded id
+func (db *SQLiteDB) GetReport(id int) (Report, error) {
+	return scanReport(db.conn.QueryRow("SELECT "+reportColumns+" FROM reports WHERE id = ?", id))
+}
+
+// GetReports returns a page of the reports in the query status, oldest first
+func (db *SQLiteDB) GetReports(query ReportQuery) ([]Report, error) {
+	stmt := "SELECT " + reportColumns + " FROM reports WHERE status = ? AND id > ? ORDER BY id"
+	args := []any{query.Status, query.AfterID}
+	if query.Limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	rows, err := db.conn.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// GetReportActions returns the log of the report in the order the actions were taken
+func (db *SQLiteDB) GetReportActions(reportID int) ([]ReportAction, error) {
+	rows, err := db.conn.Query("SELECT id, report_id, actor_id, action, note, created_at FROM report_actions WHERE report_id = ? ORDER BY id", reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []ReportAction{}
+	for rows.Next() {
+		action := ReportAction{}
+		var createdAt int64
+		err := rows.Scan(&action.ID, &action.ReportID, &action.ActorID, &action.Action, &action.Note, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		action.CreatedAt = fromUnixNano(createdAt)
+		actions = append(actions, action)
+	}
+
+	return actions, rows.Err()
+}
+
+// ClaimReport assigns the report to the moderator and logs it
+func (db *SQLiteDB) ClaimReport(id, moderatorID int) (Report, error) {
+	return db.updateReport(id, func(report Report, now time.Time) (Report, ReportAction, error) {
+		return report.claim(moderatorID, now)
+	}, nil)
+}
+
+// ResolveReport closes the report with the resolution and logs it.
+// Carrying out the resolution is up to the caller.
+func (db *SQLiteDB) ResolveReport(id, moderatorID int, resolution Resolution, note string) (Report, error) {
+	return db.updateReport(id, func(report Report, now time.Time) (Report, ReportAction, error) {
+		return report.resolve(moderatorID, resolution, note, now)
+	}, resolveReportTx)
+}
+
+// resolveReportTx carries out the resolution of the report inside a transaction.
+// Moderators and admins are not suspended, so that they can't take each other down.
+func resolveReportTx(tx *sql.Tx, report Report) error {
+	switch report.Resolution {
+	case ResolutionHideChirp:
+		// a chirp deleted meanwhile has nothing left to hide
+		_, err := tx.Exec("UPDATE chirps SET hidden = 1 WHERE id = ? AND deleted = 0", report.ChirpID)
+		return err
+	case ResolutionSuspendUser:
+		var role Role
+		err := tx.QueryRow("SELECT role FROM users WHERE id = ?", report.UserID).Scan(&role)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotExist
+		}
+		if err != nil {
+			return err
+		}
+		if role != RoleUser {
+			return ErrSuspendStaff
+		}
+
+		_, err = tx.Exec("UPDATE users SET suspended = 1 WHERE id = ?", report.UserID)
+		return err
+	}
+
+	return nil
+}
+
+// UnhideReport logs the moderator showing again the chirp hidden by the report.
+// Showing the chirp is up to the caller.
+func (db *SQLiteDB) UnhideReport(id, moderatorID int, note string) (Report, error) {
+	return db.updateReport(id, func(report Report, now time.Time) (Report, ReportAction, error) {
+		return report.unhide(moderatorID, note, now)
+	}, nil)
+}
+
+// updateReport saves the report changed by update together with its log entry
+// and the changes of effect, when not nil, all in one transaction
+func (db *SQLiteDB) updateReport(id int, update func(report Report, now time.Time) (Report, ReportAction, error), effect func(tx *sql.Tx, report Report) error) (Report, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback()
+
+	report, err := scanReport(tx.QueryRow("SELECT "+reportColumns+" FROM reports WHERE id = ?", id))
+	if err != nil {
+		return Report{}, err
+	}
+
+	report, action, err := update(report, time.Now().UTC())
+	if err != nil {
+		return Report{}, err
+	}
+
+	_, err = tx.Exec("UPDATE reports SET status = ?, claimed_by = ?, resolution = ?, updated_at = ? WHERE id = ?",
+		report.Status, report.ClaimedBy, report.Resolution, toUnixNano(report.UpdatedAt), id)
+	if err != nil {
+		return Report{}, err
+	}
+
+	err = db.insertReportAction(tx, action)
+	if err != nil {
+		return Report{}, err
+	}
+
+	if effect != nil {
+		err = effect(tx, report)
+		if err != nil {
+			return Report{}, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+// insertReportAction appends the action to the log of its report
+func (db *SQLiteDB) insertReportAction(tx *sql.Tx, action ReportAction) error {
+	_, err := tx.Exec("INSERT INTO report_actions (id, report_id, actor_id, action, note, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		db.nextID(), action.ReportID, action.ActorID, action.Action, action.Note, toUnixNano(action.CreatedAt))
+	return err
+}
+
+// scanReport reads a row selected with reportColumns
+func scanReport(row interface{ Scan(dest ...any) error }) (Report, error) {
+	report := Report{}
+	var createdAt, updatedAt int64
+	err := row.Scan(&report.ID, &report.ReporterID, &report.ChirpID, &report.UserID, &report.Reason, &report.Details,
+		&report.Status, &report.ClaimedBy, &report.Resolution, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrNotExist
+	}
+	if err != nil {
+		return Report{}, err
+	}
+	report.CreatedAt = fromUnixNano(createdAt)
+	report.UpdatedAt = fromUnixNano(updatedAt)
+
+	return report, nil
+}
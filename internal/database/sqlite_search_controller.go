@@ -0,0 +1,163 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// indexChirpText adds the words of a chirp body to the full-text index
+func indexChirpText(tx *sql.Tx, chirpID int, body string) error {
+	tokens := tokenize(body)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	for term, positions := range termPositions(tokens) {
+		encoded := make([]string, 0, len(positions))
+		for _, position := range positions {
+			encoded = append(encoded, strconv.Itoa(position))
+		}
+		_, err := tx.Exec("INSERT INTO search_postings (term, chirp_id, positions) VALUES (?, ?, ?)",
+			term, chirpID, strings.Join(encoded, " "))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec("INSERT INTO search_docs (chirp_id, length) VALUES (?, ?)", chirpID, len(tokens))
+	return err
+}
+
+// backfillSearchIndex indexes the bodies of the chirps written before the full-text index existed
+func backfillSearchIndex(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, body FROM chirps WHERE deleted = 0")
+	if err != nil {
+		return err
+	}
+
+	bodies := map[int]string{}
+	for rows.Next() {
+		var id int
+		var body string
+		err := rows.Scan(&id, &body)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		bodies[id] = body
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, body := range bodies {
+		err := indexChirpText(tx, id, body)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SearchChirps returns the page of chirps matching the query, best match first
+func (db *SQLiteDB) SearchChirps(query SearchQuery) ([]SearchResult, error) {
+	parsed := parseSearch(query.Text)
+	if len(parsed.Terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	stats := searchStats{DocumentFrequency: map[string]int{}}
+	err := db.conn.QueryRow("SELECT COUNT(*), COALESCE(SUM(length), 0) FROM search_docs").
+		Scan(&stats.Documents, &stats.TotalLength)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := make([]any, 0, len(parsed.Terms))
+	for _, term := range parsed.Terms {
+		terms = append(terms, term)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(terms)), ", ")
+
+	rows, err := db.conn.Query("SELECT term, COUNT(*) FROM search_postings WHERE term IN ("+placeholders+") GROUP BY term", terms...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var term string
+		var count int
+		err := rows.Scan(&term, &count)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.DocumentFrequency[term] = count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stmt := `SELECT p.term, p.chirp_id, p.positions, d.length FROM search_postings p
+		JOIN search_docs d ON d.chirp_id = p.chirp_id
+		JOIN chirps c ON c.id = p.chirp_id AND c.hidden = 0`
+	args := []any{}
+	if query.AuthorID != 0 {
+		stmt += " AND c.author_id = ?"
+		args = append(args, query.AuthorID)
+	}
+	stmt += " WHERE p.term IN (" + placeholders + ")"
+	args = append(args, terms...)
+
+	rows, err = db.conn.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	postings := map[string]map[int][]int{}
+	lengths := map[int]int{}
+	for rows.Next() {
+		var term, encoded string
+		var chirpID, length int
+		err := rows.Scan(&term, &chirpID, &encoded, &length)
+		if err != nil {
+			return nil, err
+		}
+
+		positions := []int{}
+		for _, field := range strings.Fields(encoded) {
+			position, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, err
+			}
+			positions = append(positions, position)
+		}
+
+		if postings[term] == nil {
+			postings[term] = map[int][]int{}
+		}
+		postings[term][chirpID] = positions
+		lengths[chirpID] = length
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results := []SearchResult{}
+	for _, hit := range rankSearch(parsed, stats, postings, lengths, query) {
+		chirp, err := db.GetChirpsById(hit.ID)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, SearchResult{
+			Chirp: chirp,
+			Score: hit.Score,
+		})
+	}
+
+	return results, nil
+}
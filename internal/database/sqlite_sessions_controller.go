@@ -0,0 +1,194 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const sessionColumns = "id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at"
+
+// CreateSession saves a new session together with the first refresh token of its family
+func (db *SQLiteDB) CreateSession(session Session, token RefreshToken) (Session, error) {
+	now := time.Now().UTC()
+	session.CreatedAt = now
+	session.LastUsedAt = now
+	session.ExpiresAt = token.ExpiresAt
+	token.FamilyID = session.ID
+	token.UserID = session.UserID
+	token.CreatedAt = now
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Session{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO sessions ("+sessionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		session.ID, session.UserID, session.UserAgent, session.IP,
+		toUnixNano(session.CreatedAt), toUnixNano(session.LastUsedAt), toUnixNano(session.ExpiresAt), toUnixNano(session.RevokedAt))
+	if err != nil {
+		return Session{}, err
+	}
+
+	err = insertRefreshToken(tx, token)
+	if err != nil {
+		return Session{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Session{}, err
+	}
+
+	return session, nil
+}
+
+// GetSession returns the session with the ID
+func (db *SQLiteDB) GetSession(ID string) (Session, error) {
+	session, err := scanSession(db.conn.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = ?", ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrNotExist
+	}
+
+	return session, err
+}
+
+// GetUserSessions returns the active sessions of the user, most recently used first
+func (db *SQLiteDB) GetUserSessions(userID int) ([]Session, error) {
+	rows, err := db.conn.Query("SELECT "+sessionColumns+" FROM sessions WHERE user_id = ? AND revoked_at = 0 AND expires_at > ? ORDER BY last_used_at DESC, id",
+		userID, toUnixNano(time.Now().UTC()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchSession records a use of the session at the time
+func (db *SQLiteDB) TouchSession(ID string, at time.Time) error {
+	res, err := db.conn.Exec("UPDATE sessions SET last_used_at = MAX(last_used_at, ?) WHERE id = ?", toUnixNano(at), ID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotExist
+	}
+
+	return nil
+}
+
+// RevokeSession logs the session out and revokes its refresh tokens
+func (db *SQLiteDB) RevokeSession(ID string) error {
+	_, err := db.GetSession(ID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = revokeSession(tx, ID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeUserSessions logs out every session of the user
+// and returns how many were still active
+func (db *SQLiteDB) RevokeUserSessions(userID int) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := toUnixNano(time.Now().UTC())
+	res, err := tx.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at = 0 AND expires_at > ?", now, userID, now)
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at = 0", now, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), tx.Commit()
+}
+
+// DeleteExpiredSessions removes the sessions and the refresh tokens that expired
+// before the time and returns how many sessions were removed
+func (db *SQLiteDB) DeleteExpiredSessions(before time.Time) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM sessions WHERE expires_at < ?", toUnixNano(before))
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("DELETE FROM refresh_tokens WHERE expires_at < ?", toUnixNano(before))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), tx.Commit()
+}
+
+// revokeSession revokes the session and the tokens of its family not revoked yet
+func revokeSession(conn sqlExecer, ID string, now time.Time) error {
+	_, err := conn.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at = 0", toUnixNano(now), ID)
+	if err != nil {
+		return err
+	}
+
+	return revokeRefreshTokenFamily(conn, ID, now)
+}
+
+// scanSession reads a row selected with sessionColumns
+func scanSession(row interface{ Scan(dest ...any) error }) (Session, error) {
+	session := Session{}
+	var createdAt, lastUsedAt, expiresAt, revokedAt int64
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &createdAt, &lastUsedAt, &expiresAt, &revokedAt)
+	if err != nil {
+		return Session{}, err
+	}
+	session.CreatedAt = fromUnixNano(createdAt)
+	session.LastUsedAt = fromUnixNano(lastUsedAt)
+	session.ExpiresAt = fromUnixNano(expiresAt)
+	session.RevokedAt = fromUnixNano(revokedAt)
+
+	return session, nil
+}
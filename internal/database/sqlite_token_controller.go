@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const refreshTokenColumns = "id, family_id, user_id, used_at, revoked_at, expires_at, created_at"
+
+// RotateRefreshToken marks the token as used, saves next in its family and
+// extends the session of the family.
+// Using a token twice revokes the whole session and returns ErrTokenReused.
+func (db *SQLiteDB) RotateRefreshToken(ID string, next RefreshToken) (RefreshToken, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	token, err := scanRefreshToken(tx.QueryRow("SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE id = ?", ID))
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	now := time.Now().UTC()
+	used, next, err := token.rotate(next, now)
+	if errors.Is(err, ErrTokenReused) {
+		revokeErr := revokeSession(tx, token.FamilyID, now)
+		if revokeErr == nil {
+			revokeErr = tx.Commit()
+		}
+		if revokeErr != nil {
+			return RefreshToken{}, revokeErr
+		}
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET used_at = ? WHERE id = ?", toUnixNano(used.UsedAt), used.ID)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	err = insertRefreshToken(tx, next)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	_, err = tx.Exec("UPDATE sessions SET last_used_at = ?, expires_at = ? WHERE id = ?",
+		toUnixNano(now), toUnixNano(next.ExpiresAt), next.FamilyID)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	return next, nil
+}
+
+// GetRefreshToken returns the refresh token with the jti
+func (db *SQLiteDB) GetRefreshToken(ID string) (RefreshToken, error) {
+	return scanRefreshToken(db.conn.QueryRow("SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE id = ?", ID))
+}
+
+// RevokeRefreshToken revokes the session of the token together with all its tokens
+func (db *SQLiteDB) RevokeRefreshToken(ID string) error {
+	token, err := db.GetRefreshToken(ID)
+	if err != nil {
+		return err
+	}
+
+	return revokeSession(db.conn, token.FamilyID, time.Now().UTC())
+}
+
+// sqlExecer runs statements on a connection or inside a transaction
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insertRefreshToken saves a new refresh token
+func insertRefreshToken(conn sqlExecer, token RefreshToken) error {
+	_, err := conn.Exec("INSERT INTO refresh_tokens ("+refreshTokenColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		token.ID, token.FamilyID, token.UserID, toUnixNano(token.UsedAt), toUnixNano(token.RevokedAt), toUnixNano(token.ExpiresAt), toUnixNano(token.CreatedAt))
+	return err
+}
+
+// revokeRefreshTokenFamily revokes the tokens of the family not revoked yet
+func revokeRefreshTokenFamily(conn sqlExecer, familyID string, now time.Time) error {
+	_, err := conn.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at = 0", toUnixNano(now), familyID)
+	return err
+}
+
+// scanRefreshToken reads a row selected with refreshTokenColumns
+func scanRefreshToken(row *sql.Row) (RefreshToken, error) {
+	token := RefreshToken{}
+	var usedAt, revokedAt, expiresAt, createdAt int64
+	err := row.Scan(&token.ID, &token.FamilyID, &token.UserID, &usedAt, &revokedAt, &expiresAt, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, ErrNotExist
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	token.UsedAt = fromUnixNano(usedAt)
+	token.RevokedAt = fromUnixNano(revokedAt)
+	token.ExpiresAt = fromUnixNano(expiresAt)
+	token.CreatedAt = fromUnixNano(createdAt)
+
+	return token, nil
+}
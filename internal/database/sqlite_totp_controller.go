@@ -0,0 +1,214 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CreateTOTP starts an enrollment, replacing a pending one of the user
+func (db *SQLiteDB) CreateTOTP(totp TOTP) (TOTP, error) {
+	_, err := db.GetUserByID(totp.UserID)
+	if err != nil {
+		return TOTP{}, err
+	}
+	totp.Enabled = false
+	totp.LastStep = 0
+	totp.RecoveryCodeHashes = []string{}
+	totp.CreatedAt = time.Now().UTC()
+	totp.EnabledAt = time.Time{}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return TOTP{}, err
+	}
+	defer tx.Rollback()
+
+	var enabled bool
+	err = tx.QueryRow("SELECT enabled FROM totp WHERE user_id = ?", totp.UserID).Scan(&enabled)
+	if err == nil && enabled {
+		return TOTP{}, ErrTOTPEnabled
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return TOTP{}, err
+	}
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", totp.UserID)
+	if err != nil {
+		return TOTP{}, err
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO totp (user_id, secret, enabled, last_step, created_at, enabled_at) VALUES (?, ?, 0, 0, ?, 0)",
+		totp.UserID, totp.Secret, toUnixNano(totp.CreatedAt))
+	if err != nil {
+		return TOTP{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return TOTP{}, err
+	}
+
+	return totp, nil
+}
+
+// GetTOTP returns the enrolled or pending authenticator of the user
+func (db *SQLiteDB) GetTOTP(userID int) (TOTP, error) {
+	totp := TOTP{UserID: userID}
+	var createdAt, enabledAt int64
+	err := db.conn.QueryRow("SELECT secret, enabled, last_step, created_at, enabled_at FROM totp WHERE user_id = ?", userID).
+		Scan(&totp.Secret, &totp.Enabled, &totp.LastStep, &createdAt, &enabledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TOTP{}, ErrNotExist
+	}
+	if err != nil {
+		return TOTP{}, err
+	}
+	totp.CreatedAt = fromUnixNano(createdAt)
+	totp.EnabledAt = fromUnixNano(enabledAt)
+
+	rows, err := db.conn.Query("SELECT code_hash FROM recovery_codes WHERE user_id = ? ORDER BY code_hash", userID)
+	if err != nil {
+		return TOTP{}, err
+	}
+	defer rows.Close()
+
+	totp.RecoveryCodeHashes = []string{}
+	for rows.Next() {
+		var hash string
+		err = rows.Scan(&hash)
+		if err != nil {
+			return TOTP{}, err
+		}
+		totp.RecoveryCodeHashes = append(totp.RecoveryCodeHashes, hash)
+	}
+
+	return totp, rows.Err()
+}
+
+// EnableTOTP confirms the pending enrollment of the user with the time step of its first code
+// and saves the hashes of the recovery codes
+func (db *SQLiteDB) EnableTOTP(userID int, step int64, recoveryCodeHashes []string) (TOTP, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return TOTP{}, err
+	}
+	defer tx.Rollback()
+
+	var enabled bool
+	err = tx.QueryRow("SELECT enabled FROM totp WHERE user_id = ?", userID).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TOTP{}, ErrNotExist
+	}
+	if err != nil {
+		return TOTP{}, err
+	}
+	if enabled {
+		return TOTP{}, ErrTOTPEnabled
+	}
+
+	_, err = tx.Exec("UPDATE totp SET enabled = 1, last_step = ?, enabled_at = ? WHERE user_id = ?",
+		step, toUnixNano(time.Now().UTC()), userID)
+	if err != nil {
+		return TOTP{}, err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.Exec("INSERT INTO recovery_codes (code_hash, user_id) VALUES (?, ?)", hash, userID)
+		if err != nil {
+			return TOTP{}, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return TOTP{}, err
+	}
+
+	return db.GetTOTP(userID)
+}
+
+// UseTOTPStep records a code accepted for the time step.
+// It returns ErrCodeUsed unless the step is later than the last one used.
+func (db *SQLiteDB) UseTOTPStep(userID int, step int64) error {
+	res, err := db.conn.Exec("UPDATE totp SET last_step = ? WHERE user_id = ? AND enabled = 1 AND last_step < ?", step, userID, step)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	totp, err := db.GetTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !totp.Enabled {
+		return ErrNotExist
+	}
+
+	return ErrCodeUsed
+}
+
+// UseRecoveryCode removes the recovery code with the hash, so that it works once,
+// and returns how many codes are left
+func (db *SQLiteDB) UseRecoveryCode(userID int, codeHash string) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ? AND code_hash = ?", userID, codeHash)
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, ErrNotExist
+	}
+
+	var remaining int
+	err = tx.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?", userID).Scan(&remaining)
+	if err != nil {
+		return 0, err
+	}
+
+	return remaining, tx.Commit()
+}
+
+// DeleteTOTP turns two-factor authentication off for the user, dropping the recovery codes
+func (db *SQLiteDB) DeleteTOTP(userID int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM totp WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotExist
+	}
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+const userColumns = "id, email, password, handle, is_chirpy_red, role, suspended, verified"
+
+// CreateUser creates a new user and saves it to the database
+func (db *SQLiteDB) CreateUSer(email, password, handle string) (User, error) {
+	if _, err := db.GetUserByEmail(email); !errors.Is(err, ErrNotExist) {
+		return User{}, ErrUserAlreadyExists
+	}
+	if _, err := db.GetUserByHandle(handle); !errors.Is(err, ErrNotExist) {
+		return User{}, ErrHandleTaken
+	}
+
+	res, err := db.conn.Exec("INSERT INTO users (id, email, password, handle) VALUES (?, ?, ?, ?)", db.nextID(), email, password, handle)
+	if err != nil {
+		return User{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return User{}, err
+	}
+
+	return User{
+		ID:         int(id),
+		Email:      email,
+		Password:   password,
+		Handle:     handle,
+		IsChirpRed: false,
+		Role:       RoleUser,
+	}, nil
+}
+
+// GetUserByEmail returns the user with the corresponded email, ignoring case
+func (db *SQLiteDB) GetUserByEmail(email string) (User, error) {
+	return db.getUser("SELECT "+userColumns+" FROM users WHERE email = ? COLLATE NOCASE", email)
+}
+
+// GetUserByHandle returns the user with the corresponded handle, ignoring case
+func (db *SQLiteDB) GetUserByHandle(handle string) (User, error) {
+	if handle == "" {
+		return User{}, ErrNotExist
+	}
+
+	return db.getUser("SELECT "+userColumns+" FROM users WHERE handle = ? COLLATE NOCASE", handle)
+}
+
+// GetUserByID returns the user with the corresponded id
+func (db *SQLiteDB) GetUserByID(userID int) (User, error) {
+	return db.getUser("SELECT "+userColumns+" FROM users WHERE id = ?", userID)
+}
+
+// UpdateUser returns the updated user
+func (db *SQLiteDB) UpdateUser(id int, email, password, handle string) (User, error) {
+	user, err := db.GetUserByID(id)
+	if err != nil {
+		return User{}, ErrNotExist
+	}
+	if owner, err := db.GetUserByHandle(handle); err == nil && owner.ID != id {
+		return User{}, ErrHandleTaken
+	}
+	if owner, err := db.GetUserByEmail(email); err == nil && owner.ID != id {
+		return User{}, ErrEmailTaken
+	}
+	if !strings.EqualFold(email, user.Email) {
+		user.Verified = false
+	}
+
+	_, err = db.conn.Exec("UPDATE users SET email = ?, password = ?, handle = ?, verified = ? WHERE id = ?", email, password, handle, user.Verified, id)
+	if err != nil {
+		return User{}, err
+	}
+
+	user.Email = email
+	user.Password = password
+	user.Handle = handle
+
+	return user, nil
+}
+
+// UpgradeUser returns the upgraded user to chirpy red
+func (db *SQLiteDB) UpgradeUser(user User) (User, error) {
+	_, err := db.conn.Exec("UPDATE users SET is_chirpy_red = 1 WHERE id = ?", user.ID)
+	if err != nil {
+		return User{}, err
+	}
+
+	user.IsChirpRed = true
+
+	return user, nil
+}
+
+// SetUserRole returns the user with its role changed
+func (db *SQLiteDB) SetUserRole(userID int, role Role) (User, error) {
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		return User{}, err
+	}
+
+	_, err = db.conn.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID)
+	if err != nil {
+		return User{}, err
+	}
+
+	user.Role = role
+
+	return user, nil
+}
+
+// getUser returns the single user matched by query
+func (db *SQLiteDB) getUser(query string, args ...any) (User, error) {
+	user := User{}
+	err := db.conn.QueryRow(query, args...).
+		Scan(&user.ID, &user.Email, &user.Password, &user.Handle, &user.IsChirpRed, &user.Role, &user.Suspended, &user.Verified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotExist
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
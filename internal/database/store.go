@@ -0,0 +1,122 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// Store is the storage backend used by the API handlers.
+// Both the JSON file database and the SQLite database implement it.
+type Store interface {
+	// Chirps
+	CreateChirp(params CreateChirpParams) (Chirp, error)
+	GetChirps() ([]Chirp, error)
+	GetChirpsById(id int) (Chirp, error)
+	GetChirpsByAuthorId(authorID int) ([]Chirp, error)
+	GetChirpsPage(query ChirpQuery) ([]Chirp, error)
+	DeleteChirp(chirp Chirp) error
+	SetChirpHidden(id int, hidden bool) (Chirp, error)
+	GetChirpAncestors(id int) ([]Chirp, error)
+	GetChirpDescendants(id int, query ThreadQuery) ([]ThreadChirp, error)
+	SearchChirps(query SearchQuery) ([]SearchResult, error)
+
+	// Users
+	CreateUSer(email, password, handle string) (User, error)
+	GetUserByEmail(email string) (User, error)
+	GetUserByHandle(handle string) (User, error)
+	GetUserByID(userID int) (User, error)
+	UpdateUser(id int, email, password, handle string) (User, error)
+	UpgradeUser(user User) (User, error)
+	SetUserRole(userID int, role Role) (User, error)
+
+	// Hashtags
+	GetTrendingHashtags(query TrendingQuery) ([]TrendingHashtag, error)
+
+	// Likes
+	LikeChirp(userID, chirpID int) (Chirp, error)
+	UnlikeChirp(userID, chirpID int) (Chirp, error)
+	GetLikedChirps(userID int, chirpIDs []int) (map[int]bool, error)
+
+	// Follows
+	FollowUser(followerID, followeeID int) (Follow, error)
+	UnfollowUser(followerID, followeeID int) error
+	GetFollowers(userID int, query FollowQuery) ([]Follow, error)
+	GetFollowing(userID int, query FollowQuery) ([]Follow, error)
+
+	// Reports
+	CreateReport(params CreateReportParams) (Report, error)
+	GetReport(id int) (Report, error)
+	GetReports(query ReportQuery) ([]Report, error)
+	GetReportActions(reportID int) ([]ReportAction, error)
+	ClaimReport(id, moderatorID int) (Report, error)
+	ResolveReport(id, moderatorID int, resolution Resolution, note string) (Report, error)
+	UnhideReport(id, moderatorID int, note string) (Report, error)
+
+	// Sessions and refresh tokens
+	CreateSession(session Session, token RefreshToken) (Session, error)
+	GetSession(ID string) (Session, error)
+	GetUserSessions(userID int) ([]Session, error)
+	TouchSession(ID string, at time.Time) error
+	RevokeSession(ID string) error
+	RevokeUserSessions(userID int) (int, error)
+	DeleteExpiredSessions(before time.Time) (int, error)
+	RotateRefreshToken(ID string, next RefreshToken) (RefreshToken, error)
+	GetRefreshToken(ID string) (RefreshToken, error)
+	RevokeRefreshToken(ID string) error
+
+	// Password resets
+	CreatePasswordReset(reset PasswordReset) (PasswordReset, error)
+	ResetPassword(tokenHash, password string) (User, error)
+	DeleteExpiredPasswordResets(before time.Time) (int, error)
+
+	// Email verifications
+	CreateEmailVerification(verification EmailVerification) (EmailVerification, error)
+	VerifyEmail(tokenHash string) (User, error)
+	DeleteExpiredEmailVerifications(before time.Time) (int, error)
+
+	// Two-factor authentication
+	CreateTOTP(totp TOTP) (TOTP, error)
+	GetTOTP(userID int) (TOTP, error)
+	EnableTOTP(userID int, step int64, recoveryCodeHashes []string) (TOTP, error)
+	UseTOTPStep(userID int, step int64) error
+	UseRecoveryCode(userID int, codeHash string) (int, error)
+	DeleteTOTP(userID int) error
+
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// Options configures a storage backend
+type Options struct {
+	// SnowflakeIDs makes the create paths allocate time-ordered 64-bit IDs
+	// instead of per-entity sequence numbers
+	SnowflakeIDs bool
+	// SnowflakeNode identifies this instance inside the generated IDs (0-1023)
+	SnowflakeNode int
+}
+
+// newIDGenerator returns the snowflake generator selected by opts, or nil for sequences
+func newIDGenerator(opts Options) (*snowflake, error) {
+	if !opts.SnowflakeIDs {
+		return nil, nil
+	}
+
+	return newSnowflake(opts.SnowflakeNode)
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*SQLiteDB)(nil)
+)
+
+// Open opens the store for the selected backend ("json" or "sqlite")
+func Open(backend, path string, opts Options) (Store, error) {
+	switch backend {
+	case "json":
+		return NewDB(path, opts)
+	case "sqlite":
+		return NewSQLiteDB(path, opts)
+	}
+
+	return nil, fmt.Errorf("unknown storage backend: %s", backend)
+}
@@ -5,51 +5,103 @@ import (
 	"time"
 )
 
-type RevokedToken struct {
-	ID         string
-	RevokeTime time.Time
+// RefreshToken tracks a refresh token handed out to a user by its jti.
+// Every refresh replaces the token with a new one of the same family;
+// the family starts at login and is revoked as a whole.
+type RefreshToken struct {
+	ID       string
+	FamilyID string
+	UserID   int
+	// UsedAt is set once the token was exchanged for a new one
+	UsedAt time.Time
+	// RevokedAt is set when the family of the token was revoked
+	RevokedAt time.Time
+	ExpiresAt time.Time
+	CreatedAt time.Time
 }
 
-var ErrTokenAlreadyExists = errors.New("the refesh token is already revoked")
+var ErrTokenRevoked = errors.New("the refresh token is revoked")
+var ErrTokenReused = errors.New("the refresh token was already used")
 
-// AddRevokeToken adds the refresh token as revoked to the database
-func (db *DB) AddRevokeToken(token string) error {
-	if _, err := db.GetRevokedTokenById(token); !errors.Is(err, ErrNotExist) {
-		return ErrTokenAlreadyExists
+// RotateRefreshToken marks the token as used, saves next in its family and
+// extends the session of the family.
+// Using a token twice revokes the whole session and returns ErrTokenReused.
+func (db *DB) RotateRefreshToken(ID string, next RefreshToken) (RefreshToken, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	token, ok := db.data.RefreshTokens[ID]
+	if !ok {
+		return RefreshToken{}, ErrNotExist
 	}
 
-	dbStructure, err := db.loadDB()
+	now := time.Now().UTC()
+	used, next, err := token.rotate(next, now)
+	if errors.Is(err, ErrTokenReused) {
+		revokeErr := db.commit(db.revokeSessionOps(token.FamilyID, now)...)
+		if revokeErr != nil {
+			return RefreshToken{}, revokeErr
+		}
+	}
 	if err != nil {
-		return err
+		return RefreshToken{}, err
 	}
 
-	ID := token
-	revokedToken := RevokedToken{
-		ID:         token,
-		RevokeTime: time.Now().UTC(),
+	ops := []walOp{putOp("refresh_tokens", used.ID, used), putOp("refresh_tokens", next.ID, next)}
+	session, ok := db.data.Sessions[token.FamilyID]
+	if ok {
+		session.LastUsedAt = now
+		session.ExpiresAt = next.ExpiresAt
+		ops = append(ops, putOp("sessions", session.ID, session))
 	}
 
-	dbStructure.RevokedTokens[ID] = revokedToken
-
-	err = db.writeDB(dbStructure)
+	err = db.commit(ops...)
 	if err != nil {
-		return err
+		return RefreshToken{}, err
 	}
 
-	return nil
+	return next, nil
 }
 
-// GetRevokedTokenById returns the revoked token with the specified ID
-func (db *DB) GetRevokedTokenById(tokenID string) (RevokedToken, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return RevokedToken{}, err
+// rotate returns the token marked as used and next as its successor in the family
+func (token RefreshToken) rotate(next RefreshToken, now time.Time) (RefreshToken, RefreshToken, error) {
+	if !token.RevokedAt.IsZero() {
+		return RefreshToken{}, RefreshToken{}, ErrTokenRevoked
+	}
+	if !token.UsedAt.IsZero() {
+		return RefreshToken{}, RefreshToken{}, ErrTokenReused
+	}
+
+	token.UsedAt = now
+	next.FamilyID = token.FamilyID
+	next.UserID = token.UserID
+	next.CreatedAt = now
+
+	return token, next, nil
+}
+
+// GetRefreshToken returns the refresh token with the jti
+func (db *DB) GetRefreshToken(ID string) (RefreshToken, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	token, ok := db.data.RefreshTokens[ID]
+	if !ok {
+		return RefreshToken{}, ErrNotExist
 	}
 
-	revokedToken, ok := dbStructure.RevokedTokens[tokenID]
+	return token, nil
+}
+
+// RevokeRefreshToken revokes the session of the token together with all its tokens
+func (db *DB) RevokeRefreshToken(ID string) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	token, ok := db.data.RefreshTokens[ID]
 	if !ok {
-		return RevokedToken{}, ErrNotExist
+		return ErrNotExist
 	}
 
-	return revokedToken, nil
+	return db.commit(db.revokeSessionOps(token.FamilyID, time.Now().UTC())...)
 }
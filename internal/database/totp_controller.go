@@ -0,0 +1,149 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// TOTP is the authenticator app a user signs in with as a second factor (RFC 6238).
+// It is pending until the user confirms the enrollment with a first code.
+type TOTP struct {
+	UserID int
+	Secret string
+	// Enabled is set once the enrollment was confirmed
+	Enabled bool
+	// LastStep is the time step of the last code accepted, codes of that step
+	// and earlier ones are refused so that a code can't be replayed
+	LastStep int64
+	// RecoveryCodeHashes are the hashes of the unused recovery codes
+	RecoveryCodeHashes []string
+	CreatedAt          time.Time
+	EnabledAt          time.Time
+}
+
+var ErrTOTPEnabled = errors.New("two-factor authentication already enabled")
+var ErrCodeUsed = errors.New("the code was already used")
+
+// CreateTOTP starts an enrollment, replacing a pending one of the user
+func (db *DB) CreateTOTP(totp TOTP) (TOTP, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	if _, ok := db.data.Users[totp.UserID]; !ok {
+		return TOTP{}, ErrNotExist
+	}
+	if existing, ok := db.data.TOTP[totp.UserID]; ok && existing.Enabled {
+		return TOTP{}, ErrTOTPEnabled
+	}
+	totp.Enabled = false
+	totp.LastStep = 0
+	totp.RecoveryCodeHashes = []string{}
+	totp.CreatedAt = time.Now().UTC()
+	totp.EnabledAt = time.Time{}
+
+	err := db.commit(putOp("totp", totp.UserID, totp))
+	if err != nil {
+		return TOTP{}, err
+	}
+
+	return totp, nil
+}
+
+// GetTOTP returns the enrolled or pending authenticator of the user
+func (db *DB) GetTOTP(userID int) (TOTP, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	totp, ok := db.data.TOTP[userID]
+	if !ok {
+		return TOTP{}, ErrNotExist
+	}
+
+	return totp, nil
+}
+
+// EnableTOTP confirms the pending enrollment of the user with the time step of its first code
+// and saves the hashes of the recovery codes
+func (db *DB) EnableTOTP(userID int, step int64, recoveryCodeHashes []string) (TOTP, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	totp, ok := db.data.TOTP[userID]
+	if !ok {
+		return TOTP{}, ErrNotExist
+	}
+	if totp.Enabled {
+		return TOTP{}, ErrTOTPEnabled
+	}
+	totp.Enabled = true
+	totp.LastStep = step
+	totp.RecoveryCodeHashes = recoveryCodeHashes
+	totp.EnabledAt = time.Now().UTC()
+
+	err := db.commit(putOp("totp", userID, totp))
+	if err != nil {
+		return TOTP{}, err
+	}
+
+	return totp, nil
+}
+
+// UseTOTPStep records a code accepted for the time step.
+// It returns ErrCodeUsed unless the step is later than the last one used.
+func (db *DB) UseTOTPStep(userID int, step int64) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	totp, ok := db.data.TOTP[userID]
+	if !ok || !totp.Enabled {
+		return ErrNotExist
+	}
+	if step <= totp.LastStep {
+		return ErrCodeUsed
+	}
+	totp.LastStep = step
+
+	return db.commit(putOp("totp", userID, totp))
+}
+
+// UseRecoveryCode removes the recovery code with the hash, so that it works once,
+// and returns how many codes are left
+func (db *DB) UseRecoveryCode(userID int, codeHash string) (int, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	totp, ok := db.data.TOTP[userID]
+	if !ok || !totp.Enabled {
+		return 0, ErrNotExist
+	}
+
+	remaining := make([]string, 0, len(totp.RecoveryCodeHashes))
+	for _, hash := range totp.RecoveryCodeHashes {
+		if hash != codeHash {
+			remaining = append(remaining, hash)
+		}
+	}
+	if len(remaining) == len(totp.RecoveryCodeHashes) {
+		return 0, ErrNotExist
+	}
+	totp.RecoveryCodeHashes = remaining
+
+	err := db.commit(putOp("totp", userID, totp))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(remaining), nil
+}
+
+// DeleteTOTP turns two-factor authentication off for the user, dropping the recovery codes
+func (db *DB) DeleteTOTP(userID int) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	if _, ok := db.data.TOTP[userID]; !ok {
+		return ErrNotExist
+	}
+
+	return db.commit(deleteOp("totp", userID))
+}
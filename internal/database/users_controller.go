@@ -4,37 +4,56 @@ import (
 	"errors"
 )
 
+// Role grants a user access to privileged routes
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
 type User struct {
-	ID         int
-	Email      string
-	Password   string
+	ID       int
+	Email    string
+	Password string
+	// Handle is the unique, case-insensitive name used in @mentions, empty when not chosen
+	Handle     string
 	IsChirpRed bool
+	Role       Role
+	// Suspended users were banned by a moderator and can't log in or post
+	Suspended bool
+	// Verified is set once the user opened a verification link sent to the email
+	Verified bool
 }
 
 var ErrUserAlreadyExists = errors.New("user already exists")
+var ErrHandleTaken = errors.New("handle already taken")
+var ErrEmailTaken = errors.New("email already taken")
 
 // CreateUser creates a new user and saves it to disk
-func (db *DB) CreateUSer(email, password string) (User, error) {
-	if _, err := db.GetUserByEmail(email); !errors.Is(err, ErrNotExist) {
+func (db *DB) CreateUSer(email, password, handle string) (User, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	if _, err := db.getUserByEmail(email); !errors.Is(err, ErrNotExist) {
 		return User{}, ErrUserAlreadyExists
 	}
-
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
+	if _, ok := db.usersByHandle[handleKey(handle)]; ok && handle != "" {
+		return User{}, ErrHandleTaken
 	}
 
-	ID := len(dbStructure.Users) + 1
+	ID, sequenceOp := db.nextID("users")
 	user := User{
 		ID:         ID,
 		Email:      email,
 		Password:   password,
+		Handle:     handle,
 		IsChirpRed: false,
+		Role:       RoleUser,
 	}
 
-	dbStructure.Users[ID] = user
-
-	err = db.writeDB(dbStructure)
+	err := db.commit(sequenceOp, putOp("users", ID, user))
 	if err != nil {
 		return User{}, err
 	}
@@ -42,30 +61,43 @@ func (db *DB) CreateUSer(email, password string) (User, error) {
 	return user, nil
 }
 
-// GetUserByEmail returns the user with the corresponded email
+// GetUserByEmail returns the user with the corresponded email, ignoring case
 func (db *DB) GetUserByEmail(email string) (User, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	return db.getUserByEmail(email)
+}
+
+// getUserByEmail looks the email up in the index; callers must hold the lock
+func (db *DB) getUserByEmail(email string) (User, error) {
+	key, ok := db.usersByEmail[emailKey(email)]
+	if !ok {
+		return User{}, ErrNotExist
 	}
 
-	for _, user := range dbStructure.Users {
-		if user.Email == email {
-			return user, nil
-		}
+	return db.data.Users[key], nil
+}
+
+// GetUserByHandle returns the user with the corresponded handle, ignoring case
+func (db *DB) GetUserByHandle(handle string) (User, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	key, ok := db.usersByHandle[handleKey(handle)]
+	if !ok || handle == "" {
+		return User{}, ErrNotExist
 	}
 
-	return User{}, ErrNotExist
+	return db.data.Users[key], nil
 }
 
 // GetUserByID returns the user with the corresponded id
 func (db *DB) GetUserByID(userID int) (User, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
+	db.mux.RLock()
+	defer db.mux.RUnlock()
 
-	user, ok := dbStructure.Users[userID]
+	user, ok := db.data.Users[userID]
 	if !ok {
 		return User{}, ErrNotExist
 	}
@@ -74,22 +106,29 @@ func (db *DB) GetUserByID(userID int) (User, error) {
 }
 
 // UpdateUser returns the updated user
-func (db *DB) UpdateUser(id int, email, password string) (User, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
+func (db *DB) UpdateUser(id int, email, password, handle string) (User, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
 
-	user, err := db.GetUserByID(id)
-	if err != nil {
+	user, ok := db.data.Users[id]
+	if !ok {
 		return User{}, ErrNotExist
 	}
+	if key, ok := db.usersByHandle[handleKey(handle)]; ok && handle != "" && key != id {
+		return User{}, ErrHandleTaken
+	}
+	if key, ok := db.usersByEmail[emailKey(email)]; ok && key != id {
+		return User{}, ErrEmailTaken
+	}
+	if emailKey(email) != emailKey(user.Email) {
+		user.Verified = false
+	}
 
 	user.Email = email
 	user.Password = password
-	dbStructure.Users[id] = user
+	user.Handle = handle
 
-	err = db.writeDB(dbStructure)
+	err := db.commit(putOp("users", id, user))
 	if err != nil {
 		return User{}, err
 	}
@@ -99,15 +138,31 @@ func (db *DB) UpdateUser(id int, email, password string) (User, error) {
 
 // UpgradeUser returns the upgraded user to chirpy red
 func (db *DB) UpgradeUser(user User) (User, error) {
-	dbStructure, err := db.loadDB()
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	user.IsChirpRed = true
+
+	err := db.commit(putOp("users", user.ID, user))
 	if err != nil {
 		return User{}, err
 	}
 
-	user.IsChirpRed = true
-	dbStructure.Users[user.ID] = user
+	return user, nil
+}
+
+// SetUserRole returns the user with its role changed
+func (db *DB) SetUserRole(userID int, role Role) (User, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	user, ok := db.data.Users[userID]
+	if !ok {
+		return User{}, ErrNotExist
+	}
+	user.Role = role
 
-	err = db.writeDB(dbStructure)
+	err := db.commit(putOp("users", userID, user))
 	if err != nil {
 		return User{}, err
 	}
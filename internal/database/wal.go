@@ -0,0 +1,260 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// defaultCompactThreshold is the number of log entries after which
+// the log is folded into a new snapshot of the database file
+const defaultCompactThreshold = 100
+
+const (
+	walOpPut    = "put"
+	walOpDelete = "delete"
+)
+
+// walOp is a single mutation appended to the write-ahead log
+type walOp struct {
+	Op         string `json:"op"`
+	Collection string `json:"collection"`
+	Key        string `json:"key"`
+	Value      any    `json:"value,omitempty"`
+}
+
+// walEntry is a walOp read back from the log
+type walEntry struct {
+	Op         string          `json:"op"`
+	Collection string          `json:"collection"`
+	Key        string          `json:"key"`
+	Value      json.RawMessage `json:"value,omitempty"`
+}
+
+// putOp records that value was stored under key in collection
+func putOp(collection string, key any, value any) walOp {
+	return walOp{
+		Op:         walOpPut,
+		Collection: collection,
+		Key:        fmt.Sprint(key),
+		Value:      value,
+	}
+}
+
+// deleteOp records that key was removed from collection
+func deleteOp(collection string, key any) walOp {
+	return walOp{
+		Op:         walOpDelete,
+		Collection: collection,
+		Key:        fmt.Sprint(key),
+	}
+}
+
+// appendWAL appends the operations to the log and syncs it to disk
+func (db *DB) appendWAL(ops ...walOp) error {
+	buf := bytes.Buffer{}
+	for _, op := range ops {
+		dat, err := json.Marshal(op)
+		if err != nil {
+			return err
+		}
+		buf.Write(dat)
+		buf.WriteByte('\n')
+	}
+
+	f, err := os.OpenFile(db.walPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+
+	db.walEntries += len(ops)
+	return nil
+}
+
+// readWAL reads the logged operations in order.
+// A torn last line, left by a crash in the middle of an append, is ignored.
+func (db *DB) readWAL() ([]walEntry, error) {
+	f, err := os.Open(db.walPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []walEntry{}
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// no trailing newline means the record was never fully written
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := walEntry{}
+		err = json.Unmarshal(line, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt write-ahead log entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// replayWAL applies the logged operations on top of the in-memory snapshot
+func (db *DB) replayWAL() error {
+	entries, err := db.readWAL()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err = db.applyOp(walOp{
+			Op:         entry.Op,
+			Collection: entry.Collection,
+			Key:        entry.Key,
+			Value:      entry.Value,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyOp applies a mutation to the in-memory structure and keeps the indexes in sync
+func (db *DB) applyOp(op walOp) error {
+	switch op.Collection {
+	case "chirps":
+		return applyToMap(db.data.Chirps, op, strconv.Atoi, db.indexChirp, db.unindexChirp)
+	case "users":
+		return applyToMap(db.data.Users, op, strconv.Atoi, db.indexUser, db.unindexUser)
+	case "refresh_tokens":
+		return applyToMap(db.data.RefreshTokens, op, parseStringKey, db.indexRefreshToken, db.unindexRefreshToken)
+	case "sessions":
+		return applyToMap(db.data.Sessions, op, parseStringKey, db.indexSession, db.unindexSession)
+	case "password_resets":
+		return applyToMap(db.data.PasswordResets, op, parseStringKey, nil, nil)
+	case "email_verifications":
+		return applyToMap(db.data.EmailVerifications, op, parseStringKey, nil, nil)
+	case "totp":
+		return applyToMap(db.data.TOTP, op, strconv.Atoi, nil, nil)
+	case "sequences":
+		return applyToMap(db.data.Sequences, op, parseStringKey, nil, nil)
+	case "follows":
+		return applyToMap(db.data.Follows, op, parseStringKey, db.indexFollow, db.unindexFollow)
+	case "likes":
+		return applyToMap(db.data.Likes, op, parseStringKey, db.indexLike, db.unindexLike)
+	case "reports":
+		return applyToMap(db.data.Reports, op, strconv.Atoi, db.indexReport, db.unindexReport)
+	case "report_actions":
+		return applyToMap(db.data.ReportActions, op, strconv.Atoi, db.indexReportAction, nil)
+	}
+
+	return fmt.Errorf("unknown collection in write-ahead log: %s", op.Collection)
+}
+
+// applyToMap applies a put or delete to one of the structure maps.
+// The value is either the typed record or, when replaying the log, its raw JSON.
+func applyToMap[K comparable, V any](m map[K]V, op walOp, parseKey func(string) (K, error), index, unindex func(K, V)) error {
+	key, err := parseKey(op.Key)
+	if err != nil {
+		return err
+	}
+
+	if old, ok := m[key]; ok && unindex != nil {
+		unindex(key, old)
+	}
+
+	switch op.Op {
+	case walOpPut:
+		var value V
+		switch v := op.Value.(type) {
+		case V:
+			value = v
+		case json.RawMessage:
+			err := json.Unmarshal(v, &value)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected value type %T in %s", op.Value, op.Collection)
+		}
+		m[key] = value
+		if index != nil {
+			index(key, value)
+		}
+	case walOpDelete:
+		delete(m, key)
+	default:
+		return fmt.Errorf("unknown write-ahead log operation: %s", op.Op)
+	}
+
+	return nil
+}
+
+// parseStringKey is the key parser for maps keyed by string
+func parseStringKey(key string) (string, error) {
+	return key, nil
+}
+
+// commit makes the operations durable in the write-ahead log and then applies them in memory.
+// The log is folded into a new snapshot once it has grown past the compaction threshold.
+// Callers must hold the write lock.
+func (db *DB) commit(ops ...walOp) error {
+	err := db.appendWAL(ops...)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		err = db.applyOp(op)
+		if err != nil {
+			return err
+		}
+	}
+
+	if db.walEntries >= db.compactThreshold {
+		return db.compact()
+	}
+
+	return nil
+}
+
+// compact writes the in-memory structure as a new snapshot and truncates the log.
+// A crash between both steps is harmless: replaying puts and deletes
+// on top of a snapshot that already contains them gives the same result.
+func (db *DB) compact() error {
+	err := db.writeDB(db.data)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(db.walPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	db.walEntries = 0
+	return nil
+}
@@ -0,0 +1,176 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is an email sent to a user
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers the emails of chirpy
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Open returns the mailer selected by the URL:
+// "log" writes the messages to the log, "file://<dir>" drops them as .eml files in the directory
+// and "smtp://host:port" hands them to an SMTP server, authenticating when username is set.
+func Open(rawURL, from, username, password string) (Mailer, error) {
+	if rawURL == "log" {
+		return &LogMailer{From: from}, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mailer: %w", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		// accept both file:///abs/dir and file://relative/dir
+		dir := u.Host + u.Path
+		if dir == "" {
+			return nil, fmt.Errorf("invalid mailer %s: missing directory", rawURL)
+		}
+		return NewFileMailer(dir, from)
+	case "smtp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("invalid mailer %s: missing port", rawURL)
+		}
+		mailer := &SMTPMailer{Addr: u.Host, From: from}
+		if username != "" {
+			mailer.Auth = smtp.PlainAuth("", username, password, u.Hostname())
+		}
+		return mailer, nil
+	}
+
+	return nil, fmt.Errorf("unknown mailer: %s", rawURL)
+}
+
+// format returns the message as an RFC 5322 email
+func format(from string, msg Message, now time.Time) []byte {
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+
+	return buf.Bytes()
+}
+
+// validHeader rejects values that would smuggle extra headers into the email
+func validHeader(value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("invalid header value: %q", value)
+	}
+	return nil
+}
+
+func validate(msg Message) error {
+	err := validHeader(msg.To)
+	if err != nil {
+		return err
+	}
+	return validHeader(msg.Subject)
+}
+
+// SMTPMailer sends the messages through an SMTP server
+type SMTPMailer struct {
+	// Addr is the host:port of the server
+	Addr string
+	From string
+	// Auth is nil for servers without authentication, such as local stand-ins
+	Auth smtp.Auth
+}
+
+func (mailer *SMTPMailer) Send(msg Message) error {
+	err := validate(msg)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(mailer.Addr, mailer.Auth, addressOf(mailer.From), []string{msg.To}, format(mailer.From, msg, time.Now()))
+}
+
+// addressOf returns the bare address of "Name <address>"
+func addressOf(from string) string {
+	if start := strings.LastIndex(from, "<"); start >= 0 {
+		return strings.TrimSuffix(from[start+1:], ">")
+	}
+	return from
+}
+
+// FileMailer drops every message as an .eml file in a directory
+type FileMailer struct {
+	Dir  string
+	From string
+
+	mux   sync.Mutex
+	count int
+}
+
+// NewFileMailer returns a mailer writing to the directory, creating it if needed
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{Dir: dir, From: from}, nil
+}
+
+func (mailer *FileMailer) Send(msg Message) error {
+	err := validate(msg)
+	if err != nil {
+		return err
+	}
+
+	mailer.mux.Lock()
+	defer mailer.mux.Unlock()
+
+	now := time.Now()
+	mailer.count++
+	name := fmt.Sprintf("%s-%04d.eml", now.UTC().Format("20060102T150405.000000000Z"), mailer.count)
+
+	return os.WriteFile(filepath.Join(mailer.Dir, name), format(mailer.From, msg, now), 0600)
+}
+
+// LogMailer writes every message to the log, for development
+type LogMailer struct {
+	From string
+}
+
+func (mailer *LogMailer) Send(msg Message) error {
+	err := validate(msg)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Mail from %s to %s: %s\n%s", mailer.From, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+var (
+	_ Mailer = (*SMTPMailer)(nil)
+	_ Mailer = (*FileMailer)(nil)
+	_ Mailer = (*LogMailer)(nil)
+)
@@ -0,0 +1,253 @@
+package moderation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+)
+
+// Action is what happens to a chirp containing a word of a rule
+type Action string
+
+const (
+	// ActionMask replaces the word with asterisks
+	ActionMask Action = "mask"
+	// ActionReject refuses the chirp
+	ActionReject Action = "reject"
+	// ActionFlag accepts the chirp but marks it for review by moderators
+	ActionFlag Action = "flag"
+)
+
+// mask replaces masked words
+const mask = "****"
+
+// ErrRejected is returned for chirps containing a word of a reject rule
+var ErrRejected = errors.New("Chirp contains a banned word")
+
+// DefaultRules are used when the rules file doesn't exist
+var DefaultRules = []Rule{
+	{Word: "kerfuffle", Action: ActionMask},
+	{Word: "sharbert", Action: ActionMask},
+	{Word: "fornax", Action: ActionMask},
+}
+
+// Rule applies an action to the chirps containing a word
+type Rule struct {
+	Word   string
+	Action Action
+}
+
+// Result is the outcome of moderating a chirp body
+type Result struct {
+	// Body is the chirp body with the masked words replaced
+	Body string
+	// Rejected is true when a word of a reject rule was found
+	Rejected bool
+	// Flagged is true when a word of a flag rule was found
+	Flagged bool
+	// Matches holds the rules the body matched
+	Matches []Rule
+}
+
+// Moderator checks chirp bodies against the rules of a file,
+// reloading the file when it changes
+type Moderator struct {
+	path    string
+	mux     sync.RWMutex
+	rules   map[string]Action
+	modTime time.Time
+}
+
+// New returns a moderator with the rules of the file at path,
+// or with DefaultRules when the file doesn't exist
+func New(path string) (*Moderator, error) {
+	m := &Moderator{path: path}
+	err := m.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// ParseRules reads rules written one per line as "<action> <word>".
+// Empty lines and lines starting with # are ignored.
+func ParseRules(r io.Reader) ([]Rule, error) {
+	rules := []Rule{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"<action> <word>\"", line)
+		}
+
+		action := Action(strings.ToLower(fields[0]))
+		if action != ActionMask && action != ActionReject && action != ActionFlag {
+			return nil, fmt.Errorf("line %d: unknown action %q", line, fields[0])
+		}
+		if Normalize(fields[1]) == "" {
+			return nil, fmt.Errorf("line %d: word %q has no letters", line, fields[1])
+		}
+
+		rules = append(rules, Rule{Word: fields[1], Action: action})
+	}
+
+	return rules, scanner.Err()
+}
+
+// Reload reads the rules file again. The current rules are kept when it fails.
+func (m *Moderator) Reload() error {
+	rules := DefaultRules
+	modTime := time.Time{}
+
+	file, err := os.Open(m.path)
+	if err == nil {
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		modTime = info.ModTime()
+
+		rules, err = ParseRules(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	byWord := map[string]Action{}
+	for _, rule := range rules {
+		byWord[Normalize(rule.Word)] = rule.Action
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.rules = byWord
+	m.modTime = modTime
+
+	return nil
+}
+
+// Watch reloads the rules whenever the modification time of the file changes,
+// checking every interval, until stop is called
+func (m *Moderator) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	m.mux.RLock()
+	lastSeen := m.modTime
+	m.mux.RUnlock()
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			modTime := time.Time{}
+			if info, err := os.Stat(m.path); err == nil {
+				modTime = info.ModTime()
+			}
+
+			// a broken file is only retried once it changes again
+			if modTime.Equal(lastSeen) {
+				continue
+			}
+			lastSeen = modTime
+
+			err := m.Reload()
+			if err != nil {
+				log.Printf("Couldn't reload moderation rules: %s", err)
+				continue
+			}
+			log.Printf("Reloaded moderation rules from %s", m.path)
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// Moderate checks every word of the body against the rules.
+// Words are matched after normalisation, with and without their surrounding punctuation,
+// and masked words keep that punctuation.
+func (m *Moderator) Moderate(body string) Result {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	result := Result{}
+
+	var cleaned strings.Builder
+	rest := body
+	for rest != "" {
+		// copy the spaces before the next word
+		wordStart := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsSpace(r) })
+		if wordStart < 0 {
+			cleaned.WriteString(rest)
+			break
+		}
+		cleaned.WriteString(rest[:wordStart])
+		rest = rest[wordStart:]
+
+		wordEnd := strings.IndexFunc(rest, unicode.IsSpace)
+		if wordEnd < 0 {
+			wordEnd = len(rest)
+		}
+		word := rest[:wordEnd]
+		rest = rest[wordEnd:]
+
+		leading, core, trailing := trimPunctuation(word)
+		normalized := Normalize(core)
+		action, ok := m.rules[normalized]
+		if !ok {
+			normalized = Normalize(word)
+			action, ok = m.rules[normalized]
+			leading, core, trailing = "", word, ""
+		}
+		if !ok {
+			cleaned.WriteString(word)
+			continue
+		}
+
+		result.Matches = append(result.Matches, Rule{Word: normalized, Action: action})
+		switch action {
+		case ActionMask:
+			core = mask
+		case ActionReject:
+			result.Rejected = true
+		case ActionFlag:
+			result.Flagged = true
+		}
+		cleaned.WriteString(leading + core + trailing)
+	}
+
+	result.Body = cleaned.String()
+	return result
+}
+
+// Length returns the number of characters of a chirp body as users see them,
+// counting grapheme clusters rather than bytes or code points
+func Length(body string) int {
+	return uniseg.GraphemeClusterCount(body)
+}
@@ -0,0 +1,71 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+)
+
+// homoglyphs maps characters that look like latin letters to those letters
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'з': '3', 'і': 'i', 'ї': 'i', 'ј': 'j', 'к': 'k',
+	'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Latin letters with diacritics
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a', 'ą': 'a',
+	'ç': 'c', 'ć': 'c', 'č': 'c',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e', 'ę': 'e', 'ě': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ī': 'i', 'ı': 'i',
+	'ñ': 'n', 'ń': 'n', 'ň': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ō': 'o',
+	'ś': 's', 'š': 's', 'ß': 's',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ū': 'u', 'ů': 'u',
+	'ý': 'y', 'ÿ': 'y',
+	'ź': 'z', 'ż': 'z', 'ž': 'z',
+}
+
+// leetspeak maps the digits and symbols used in place of letters
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '6': 'g', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'i', '+': 't', '€': 'e',
+}
+
+// Normalize folds a word to the form rules are matched against:
+// lowercase latin letters only, with homoglyphs and leetspeak replaced by the letters they imitate
+// and any other character, such as punctuation or zero-width spaces, dropped.
+func Normalize(word string) string {
+	var normalized strings.Builder
+	for _, r := range strings.ToLower(word) {
+		// fullwidth forms of ASCII characters
+		if r >= '！' && r <= '～' {
+			r = r - '！' + '!'
+		}
+		if folded, ok := homoglyphs[r]; ok {
+			r = folded
+		}
+		if folded, ok := leetspeak[r]; ok {
+			r = folded
+		}
+		if r >= 'a' && r <= 'z' {
+			normalized.WriteRune(r)
+		}
+	}
+
+	return normalized.String()
+}
+
+// trimPunctuation splits a word into its leading punctuation, its core and its trailing punctuation
+func trimPunctuation(word string) (string, string, string) {
+	isEdge := func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSymbol(r)
+	}
+
+	core := strings.TrimLeftFunc(word, isEdge)
+	leading := word[:len(word)-len(core)]
+	trimmed := strings.TrimRightFunc(core, isEdge)
+	trailing := core[len(trimmed):]
+
+	return leading, trimmed, trailing
+}
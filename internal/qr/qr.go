@@ -0,0 +1,546 @@
+// Package qr encodes text as a QR code (ISO/IEC 18004), enough to show
+// provisioning URIs to authenticator apps. It only uses byte mode
+// and the medium (M) error correction level.
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// ErrTooLong is returned for text that doesn't fit in the largest QR code
+var ErrTooLong = errors.New("text too long for a QR code")
+
+const (
+	minVersion = 1
+	maxVersion = 40
+	// quietZone is the light border around the code, in modules
+	quietZone = 4
+)
+
+// eccCodewordsPerBlock and numErrorCorrectionBlocks describe the medium level, indexed by version
+var eccCodewordsPerBlock = [maxVersion + 1]int{-1,
+	10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26,
+	26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28}
+
+var numErrorCorrectionBlocks = [maxVersion + 1]int{-1,
+	1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16,
+	17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49}
+
+// formatBitsM are the two bits naming the medium level in the format information
+const formatBitsM = 0
+
+// Code is a QR code, a square of dark and light modules
+type Code struct {
+	Version int
+	Size    int
+	// modules[y][x] is true for dark modules
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// Dark reports whether the module at column x and row y is dark
+func (code *Code) Dark(x, y int) bool {
+	return code.modules[y][x]
+}
+
+// Encode returns the smallest QR code holding the text
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+
+	version := minVersion
+	for ; ; version++ {
+		if version > maxVersion {
+			return nil, ErrTooLong
+		}
+		capacityBits := numDataCodewords(version) * 8
+		if 4+countBits(version)+len(data)*8 <= capacityBits {
+			break
+		}
+	}
+
+	bits := bitBuffer{}
+	bits.append(0x4, 4) // byte mode
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	// terminator, then padding to a byte and with the alternating pad bytes
+	capacityBits := numDataCodewords(version) * 8
+	terminator := capacityBits - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacityBits; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+
+	code := newCode(version)
+	code.drawFunctionPatterns()
+	code.drawCodewords(addEccAndInterleave(version, codewords))
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		code.applyMask(mask)
+		code.drawFormatBits(mask)
+		penalty := code.penalty()
+		if bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		// masks are their own inverse
+		code.applyMask(mask)
+	}
+	code.applyMask(bestMask)
+	code.drawFormatBits(bestMask)
+
+	return code, nil
+}
+
+// PNG renders the code with scale pixels per module and the quiet zone around it
+func (code *Code) PNG(scale int) ([]byte, error) {
+	if scale < 1 {
+		return nil, errors.New("scale must be positive")
+	}
+
+	side := (code.Size + 2*quietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			mx, my := x/scale-quietZone, y/scale-quietZone
+			dark := mx >= 0 && my >= 0 && mx < code.Size && my < code.Size && code.modules[my][mx]
+			if dark {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+
+	buf := bytes.Buffer{}
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func newCode(version int) *Code {
+	size := version*4 + 17
+	code := &Code{
+		Version:    version,
+		Size:       size,
+		modules:    make([][]bool, size),
+		isFunction: make([][]bool, size),
+	}
+	for i := range code.modules {
+		code.modules[i] = make([]bool, size)
+		code.isFunction[i] = make([]bool, size)
+	}
+
+	return code
+}
+
+// countBits is the length of the character count in byte mode
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// numRawDataModules is the number of modules left for data and error correction
+func numRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+
+	return result
+}
+
+func numDataCodewords(version int) int {
+	return numRawDataModules(version)/8 - eccCodewordsPerBlock[version]*numErrorCorrectionBlocks[version]
+}
+
+// alignmentPatternPositions returns the centers of the alignment patterns on each axis
+func alignmentPatternPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := 26
+	if version != 32 {
+		step = (version*4 + numAlign*2 + 1) / (numAlign*2 - 2) * 2
+	}
+
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+10; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+
+	return positions
+}
+
+func (code *Code) setFunctionModule(x, y int, dark bool) {
+	code.modules[y][x] = dark
+	code.isFunction[y][x] = true
+}
+
+func (code *Code) drawFunctionPatterns() {
+	for i := 0; i < code.Size; i++ {
+		code.setFunctionModule(6, i, i%2 == 0)
+		code.setFunctionModule(i, 6, i%2 == 0)
+	}
+
+	code.drawFinderPattern(3, 3)
+	code.drawFinderPattern(code.Size-4, 3)
+	code.drawFinderPattern(3, code.Size-4)
+
+	positions := alignmentPatternPositions(code.Version)
+	last := len(positions) - 1
+	for i := range positions {
+		for j := range positions {
+			// the corners taken by the finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			code.drawAlignmentPattern(positions[i], positions[j])
+		}
+	}
+
+	// reserve the format areas, filled once the mask is picked
+	code.drawFormatBits(0)
+	code.drawVersion()
+}
+
+func (code *Code) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= code.Size || yy >= code.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			code.setFunctionModule(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (code *Code) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			code.setFunctionModule(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits writes both copies of the error correction level and mask
+func (code *Code) drawFormatBits(mask int) {
+	data := formatBitsM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		code.setFunctionModule(8, i, bit(bits, i))
+	}
+	code.setFunctionModule(8, 7, bit(bits, 6))
+	code.setFunctionModule(8, 8, bit(bits, 7))
+	code.setFunctionModule(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		code.setFunctionModule(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		code.setFunctionModule(code.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		code.setFunctionModule(8, code.Size-15+i, bit(bits, i))
+	}
+	code.setFunctionModule(8, code.Size-8, true)
+}
+
+// drawVersion writes both copies of the version, carried from version 7 on
+func (code *Code) drawVersion() {
+	if code.Version < 7 {
+		return
+	}
+
+	rem := code.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := code.Version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		a, b := code.Size-11+i%3, i/3
+		code.setFunctionModule(a, b, bit(bits, i))
+		code.setFunctionModule(b, a, bit(bits, i))
+	}
+}
+
+// addEccAndInterleave splits the data in blocks, appends the error correction
+// codewords of each block and interleaves the blocks
+func addEccAndInterleave(version int, data []byte) []byte {
+	numBlocks := numErrorCorrectionBlocks[version]
+	blockEccLen := eccCodewordsPerBlock[version]
+	rawCodewords := numRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockEccLen)
+	blocks := make([][]byte, 0, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		dataLen := shortBlockLen - blockEccLen
+		if i >= numShortBlocks {
+			dataLen++
+		}
+		block := append([]byte{}, data[k:k+dataLen]...)
+		k += dataLen
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			// placeholder keeping the blocks aligned, skipped when interleaving
+			block = append(block, 0)
+		}
+		blocks = append(blocks, append(block, ecc...))
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockEccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+
+	return result
+}
+
+// drawCodewords fills the data area in the zigzag order, two columns at a time from the bottom right
+func (code *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := code.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// skip the vertical timing pattern
+			right = 5
+		}
+		for vert := 0; vert < code.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = code.Size - 1 - vert
+				}
+				if !code.isFunction[y][x] && i < len(data)*8 {
+					code.modules[y][x] = bit(int(data[i>>3]), 7-(i&7))
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (code *Code) applyMask(mask int) {
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !code.isFunction[y][x] {
+				code.modules[y][x] = !code.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to scan, the mask with the lowest score is kept
+func (code *Code) penalty() int {
+	result := 0
+	size := code.Size
+
+	// runs of five or more modules of the same color, and finder-like patterns
+	line := make([]bool, size)
+	for _, horizontal := range []bool{true, false} {
+		for a := 0; a < size; a++ {
+			for b := 0; b < size; b++ {
+				if horizontal {
+					line[b] = code.modules[a][b]
+				} else {
+					line[b] = code.modules[b][a]
+				}
+			}
+			result += runPenalty(line) + finderLikePenalty(line)
+		}
+	}
+
+	// 2x2 blocks of the same color
+	for y := 0; y < size-1; y++ {
+		for x := 0; x < size-1; x++ {
+			dark := code.modules[y][x]
+			if dark == code.modules[y][x+1] && dark == code.modules[y+1][x] && dark == code.modules[y+1][x+1] {
+				result += 3
+			}
+		}
+	}
+
+	// balance of dark and light modules
+	dark := 0
+	for _, row := range code.modules {
+		for _, module := range row {
+			if module {
+				dark++
+			}
+		}
+	}
+	total := size * size
+	result += (abs(dark*20-total*10) + total - 1) / total * 10
+
+	return result
+}
+
+func runPenalty(line []bool) int {
+	result := 0
+	for start := 0; start < len(line); {
+		end := start
+		for end < len(line) && line[end] == line[start] {
+			end++
+		}
+		if run := end - start; run >= 5 {
+			result += 3 + run - 5
+		}
+		start = end
+	}
+
+	return result
+}
+
+// finderLikePenalty scores the 1:1:3:1:1 patterns with four light modules on a side
+func finderLikePenalty(line []bool) int {
+	pattern := []bool{true, false, true, true, true, false, true}
+	result := 0
+	for i := 0; i+len(pattern) <= len(line); i++ {
+		match := true
+		for j, dark := range pattern {
+			if line[i+j] != dark {
+				match = false
+				break
+			}
+		}
+		if match && (lightRun(line, i-4, i) || lightRun(line, i+len(pattern), i+len(pattern)+4)) {
+			result += 40
+		}
+	}
+
+	return result
+}
+
+// lightRun reports whether the modules in [from, to) are light, counting those outside the code as light
+func lightRun(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// reedSolomonDivisor returns the generator polynomial of the degree, highest term omitted
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+
+	return byte(z)
+}
+
+type bitBuffer []bool
+
+func (buf *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*buf = append(*buf, bit(value, i))
+	}
+}
+
+func bit(value, i int) bool {
+	return (value>>uint(i))&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"log"
+
+	"github.com/ric-ram/go-chirpy/internal/mail"
+)
+
+// sendMail sends the message in the background, so that the response time
+// doesn't tell whether an email was sent
+func (cfg *apiConfig) sendMail(msg mail.Message) {
+	go func() {
+		err := cfg.mailer.Send(msg)
+		if err != nil {
+			log.Printf("Couldn't send %q to %s: %s", msg.Subject, msg.To, err)
+		}
+	}()
+}
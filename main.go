@@ -1,30 +1,77 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/joho/godotenv"
+	"github.com/ric-ram/go-chirpy/internal/auth"
 	"github.com/ric-ram/go-chirpy/internal/database"
+	"github.com/ric-ram/go-chirpy/internal/mail"
+	"github.com/ric-ram/go-chirpy/internal/moderation"
 )
 
+// shutdownTimeout is how long the requests in flight get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
 type apiConfig struct {
-	jwtSecret      string
+	tokens         *auth.TokenIssuer
 	polkaApiSecret string
 	fileserverHits int
-	DB             *database.DB
+	DB             database.Store
+	// trendingWindow is the default time window of the trending hashtags
+	trendingWindow time.Duration
+	moderator      *moderation.Moderator
+	mailer         mail.Mailer
+	// publicURL is where users reach chirpy, used in the links sent by email
+	publicURL string
+	// requireVerifiedEmail keeps users from posting until they verified their email
+	requireVerifiedEmail bool
+	twoFactorFailures    *twoFactorLimiter
 }
 
 var debugMode = flag.Bool("debug", false, "Enable debug mode")
+var storageBackend = flag.String("storage", "json", "Storage backend to use: json or sqlite")
+var snowflakeNode = flag.Int("snowflake-node", -1, "Allocate time-ordered snowflake IDs using this node ID (0-1023); sequences are used when unset")
+var migrateDryRun = flag.Bool("migrate-dry-run", false, "Report pending database migrations and exit")
+var trendingWindow = flag.Duration("trending-window", 24*time.Hour, "Default time window of the trending hashtags")
+var moderationRules = flag.String("moderation-rules", "moderation.txt", "File of the moderation rules, reloaded when it changes")
+var moderationReload = flag.Duration("moderation-reload", 5*time.Second, "How often to check the moderation rules file for changes")
+var jwtKeysDir = flag.String("jwt-keys", "", "Directory of the <kid>.pem Ed25519 or RSA keys signing and verifying tokens")
+var jwtSigningKey = flag.String("jwt-signing-key", "", "Kid of the key signing new tokens, needed when -jwt-keys holds several private keys")
+var jwtGenerateKey = flag.String("jwt-generate-key", "", "Write a new EdDSA or RS256 private key to the -jwt-keys directory and exit")
+var accessTokenLifetime = flag.Duration("access-token-lifetime", auth.DefaultTokenConfig().AccessLifetime, "How long access tokens are valid")
+var refreshTokenLifetime = flag.Duration("refresh-token-lifetime", auth.DefaultTokenConfig().RefreshLifetime, "How long refresh tokens are valid")
+var jwtLeeway = flag.Duration("jwt-leeway", auth.DefaultTokenConfig().Leeway, "Clock skew tolerated when checking the times of tokens")
+var mailerURL = flag.String("mailer", "log", "Where emails go: log, file://<dir> or smtp://host:port (credentials from SMTP_USERNAME and SMTP_PASSWORD)")
+var mailFrom = flag.String("mail-from", "Chirpy <no-reply@chirpy.local>", "Sender of the emails")
+var publicURL = flag.String("public-url", "http://localhost:8080", "Base URL of the links sent by email")
+var requireVerifiedEmail = flag.Bool("require-verified-email", false, "Only let users with a verified email post chirps")
+var bootstrapAdminEmail = flag.String("bootstrap-admin", "", "Give the admin role to the user with this email on startup")
 
 func main() {
+	err := run()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run starts chirpy and serves until it is stopped. Failures are returned rather than
+// exiting on the spot, so that the deferred cleanups still close the store.
+func run() error {
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		return errors.New("Error loading .env file")
 	}
 
 	jwtSecret := os.Getenv("JWT_SECRET")
@@ -32,56 +79,168 @@ func main() {
 
 	flag.Parse()
 
+	dbPath := "database.json"
+	if *storageBackend == "sqlite" {
+		dbPath = "database.db"
+	}
+
 	if *debugMode {
-		err := os.Remove("database.json")
+		err := os.Remove(dbPath)
 		if err != nil {
 			fmt.Println(err)
 		}
+		// a leftover write-ahead log would be replayed on the fresh database:
+		// ".wal" of the JSON backend, "-journal", "-wal" and "-shm" of SQLite
+		for _, suffix := range []string{".wal", "-journal", "-wal", "-shm"} {
+			err = os.Remove(dbPath + suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Println(err)
+			}
+		}
+	}
+
+	if *jwtGenerateKey != "" {
+		generateSigningKey(*jwtKeysDir, *jwtGenerateKey)
+		return nil
+	}
+
+	if *migrateDryRun {
+		printMigrationDryRun(*storageBackend, dbPath)
+		return nil
 	}
 
 	const filepathRoot = "."
 	const port = "8080"
 
-	db, err := database.NewDB("database.json")
+	db, err := database.Open(*storageBackend, dbPath, database.Options{
+		SnowflakeIDs:  *snowflakeNode >= 0,
+		SnowflakeNode: *snowflakeNode,
+	})
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer db.Close()
+
+	moderator, err := moderation.New(*moderationRules)
+	if err != nil {
+		return err
+	}
+	stopWatching := moderator.Watch(*moderationReload)
+	defer stopWatching()
+
+	keyring, err := auth.LoadKeyring(*jwtKeysDir, *jwtSigningKey, jwtSecret)
+	if err != nil {
+		return err
+	}
+
+	mailer, err := mail.Open(*mailerURL, *mailFrom, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	if err != nil {
+		return err
+	}
+
+	tokenConfig := auth.DefaultTokenConfig()
+	tokenConfig.AccessLifetime = *accessTokenLifetime
+	tokenConfig.RefreshLifetime = *refreshTokenLifetime
+	tokenConfig.Leeway = *jwtLeeway
+
+	stopPruning := pruneExpired(db, time.Hour)
+	defer stopPruning()
+
+	if *bootstrapAdminEmail != "" {
+		err = bootstrapAdmin(db, *bootstrapAdminEmail)
+		if err != nil {
+			return err
+		}
 	}
 
 	apiCfg := apiConfig{
-		jwtSecret:      jwtSecret,
-		polkaApiSecret: polkaApiSecret,
-		fileserverHits: 0,
-		DB:             db,
+		tokens:               auth.NewTokenIssuer(keyring, tokenConfig),
+		polkaApiSecret:       polkaApiSecret,
+		fileserverHits:       0,
+		DB:                   db,
+		trendingWindow:       *trendingWindow,
+		moderator:            moderator,
+		mailer:               mailer,
+		publicURL:            strings.TrimSuffix(*publicURL, "/"),
+		requireVerifiedEmail: *requireVerifiedEmail,
+		twoFactorFailures:    newTwoFactorLimiter(),
 	}
 
 	router := chi.NewRouter()
 	fsHandler := apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))))
 	router.Handle("/app", fsHandler)
 	router.Handle("/app/*", fsHandler)
+	router.Get("/.well-known/jwks.json", apiCfg.handlerJWKS)
 
 	// /api route
 	apiRouter := chi.NewRouter()
 	apiRouter.Get("/healthz", handleReadiness)
-	apiRouter.Get("/reset", apiCfg.handlerReset)
-	apiRouter.Get("/chirps", apiCfg.handlerChirpsGet)
-	apiRouter.Get("/chirps/{chirpID}", apiCfg.handlerChirpsGetById)
-
-	apiRouter.Post("/chirps", apiCfg.handlerChirpsPost)
 	apiRouter.Post("/users", apiCfg.handlerUsersPost)
 	apiRouter.Post("/login", apiCfg.handlerUserLogin)
+	apiRouter.Post("/login/2fa", apiCfg.handlerLoginTwoFactor)
 	apiRouter.Post("/refresh", apiCfg.handlerTokenRefresh)
 	apiRouter.Post("/revoke", apiCfg.handlerTokenRevoke)
+	apiRouter.Post("/password-reset/request", apiCfg.handlerPasswordResetRequest)
+	apiRouter.Post("/password-reset/confirm", apiCfg.handlerPasswordResetConfirm)
+	apiRouter.Post("/email/verify", apiCfg.handlerEmailVerify)
 	apiRouter.Post("/polka/webhooks", apiCfg.handlerChirpyRed)
 
-	apiRouter.Put("/users", apiCfg.handlerUserUpdate)
+	// public routes showing more to authenticated users
+	apiRouter.Group(func(publicRouter chi.Router) {
+		publicRouter.Use(apiCfg.middlewareOptionalAuth)
+		publicRouter.Get("/chirps", apiCfg.handlerChirpsGet)
+		publicRouter.Get("/chirps/search", apiCfg.handlerChirpsSearch)
+		publicRouter.Get("/chirps/{chirpID}", apiCfg.handlerChirpsGetById)
+		publicRouter.Get("/chirps/{chirpID}/thread", apiCfg.handlerChirpThreadGet)
+		publicRouter.Get("/users/{userID}/followers", apiCfg.handlerFollowersGet)
+		publicRouter.Get("/users/{userID}/following", apiCfg.handlerFollowingGet)
+		publicRouter.Get("/users/{userID}/mentions", apiCfg.handlerMentionsGet)
+		publicRouter.Get("/hashtags/trending", apiCfg.handlerHashtagsTrendingGet)
+		publicRouter.Get("/hashtags/{tag}/chirps", apiCfg.handlerHashtagChirpsGet)
+	})
+
+	// routes of the authenticated user
+	apiRouter.Group(func(authRouter chi.Router) {
+		authRouter.Use(apiCfg.middlewareAuth)
+		authRouter.With(apiCfg.middlewareRequirePermission(permissionResetMetrics)).Get("/reset", apiCfg.handlerReset)
+		authRouter.Get("/timeline", apiCfg.handlerTimelineGet)
+		authRouter.Get("/sessions", apiCfg.handlerSessionsGet)
+
+		authRouter.With(apiCfg.middlewareRequireVerifiedEmail).Post("/chirps", apiCfg.handlerChirpsPost)
+		authRouter.Post("/users/{userID}/follow", apiCfg.handlerFollowPost)
+		authRouter.With(apiCfg.middlewareRequireVerifiedEmail).Post("/chirps/{chirpID}/rechirp", apiCfg.handlerChirpRechirpPost)
+		authRouter.With(apiCfg.middlewareRequireVerifiedEmail).Post("/chirps/{chirpID}/quote", apiCfg.handlerChirpQuotePost)
+		authRouter.Post("/reports", apiCfg.handlerReportsPost)
+		authRouter.Post("/logout-all", apiCfg.handlerLogoutAll)
+		authRouter.Post("/email/verify/resend", apiCfg.handlerEmailVerificationResend)
+		authRouter.Post("/2fa/totp", apiCfg.handlerTOTPEnroll)
+		authRouter.Post("/2fa/totp/confirm", apiCfg.handlerTOTPConfirm)
 
-	apiRouter.Delete("/chirps/{chirpID}", apiCfg.handlerChirpDelete)
+		authRouter.Put("/users", apiCfg.handlerUserUpdate)
+		authRouter.Put("/chirps/{chirpID}/like", apiCfg.handlerChirpLikePut)
+
+		authRouter.Delete("/chirps/{chirpID}", apiCfg.handlerChirpDelete)
+		authRouter.Delete("/users/{userID}/follow", apiCfg.handlerFollowDelete)
+		authRouter.Delete("/chirps/{chirpID}/like", apiCfg.handlerChirpLikeDelete)
+		authRouter.Delete("/sessions/{sessionID}", apiCfg.handlerSessionDelete)
+		authRouter.Delete("/2fa/totp", apiCfg.handlerTOTPDelete)
+	})
 
 	router.Mount("/api", apiRouter)
 
 	// /admin route
 	adminRouter := chi.NewRouter()
-	adminRouter.Get("/metrics", apiCfg.handlerMetrics)
+	adminRouter.Use(apiCfg.middlewareAuth)
+	adminRouter.With(apiCfg.middlewareRequirePermission(permissionViewMetrics)).Get("/metrics", apiCfg.handlerMetrics)
+	adminRouter.Group(func(moderatorRouter chi.Router) {
+		moderatorRouter.Use(apiCfg.middlewareRequirePermission(permissionModerate))
+		moderatorRouter.Get("/reports", apiCfg.handlerAdminReportsGet)
+		moderatorRouter.Get("/reports/{reportID}", apiCfg.handlerAdminReportGet)
+		moderatorRouter.Post("/reports/{reportID}/claim", apiCfg.handlerAdminReportClaim)
+		moderatorRouter.Post("/reports/{reportID}/resolve", apiCfg.handlerAdminReportResolve)
+		moderatorRouter.Post("/reports/{reportID}/unhide", apiCfg.handlerAdminReportUnhide)
+	})
+	adminRouter.With(apiCfg.middlewareRequirePermission(permissionManageRoles)).Put("/users/{userID}/role", apiCfg.handlerAdminUserRolePut)
 
 	router.Mount("/admin", adminRouter)
 
@@ -92,7 +251,28 @@ func main() {
 		Handler: corsMux,
 	}
 
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(server.ListenAndServe())
+	// serve until SIGINT or SIGTERM, then return so that the deferred cleanups close the store
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := server.Shutdown(ctx)
+		if err != nil {
+			return fmt.Errorf("couldn't shut down the server: %w", err)
+		}
+	}
 
+	return nil
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+const maxHandleLength = 15
+
+// handlePattern matches the handles users can choose
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,15}$`)
+
+// validateHandle checks that a handle can be used in @mentions
+func validateHandle(handle string) error {
+	if !handlePattern.MatchString(handle) {
+		return errors.New("Handle must be 1 to 15 letters, digits or underscores")
+	}
+
+	return nil
+}
+
+// mentionToken is an @handle found in a chirp body.
+// Start and End are offsets in characters, End excluded.
+type mentionToken struct {
+	Handle string
+	Start  int
+	End    int
+}
+
+// parseMentions returns the @handles of a chirp body in order.
+// An @ that follows a word character, as in an email address, doesn't start a mention.
+func parseMentions(body string) []mentionToken {
+	tokens := []mentionToken{}
+
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && isHandleRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isHandleRune(runes[end]) {
+			end++
+		}
+		if end == i+1 || end-i-1 > maxHandleLength {
+			i = end - 1
+			continue
+		}
+
+		tokens = append(tokens, mentionToken{
+			Handle: string(runes[i+1 : end]),
+			Start:  i,
+			End:    end,
+		})
+		i = end - 1
+	}
+
+	return tokens
+}
+
+// isHandleRune reports whether r can be part of a handle
+func isHandleRune(r rune) bool {
+	return r < utf8.RuneSelf && (r == '_' || '0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+}
+
+// resolveMentions looks the @handles of a chirp body up and returns those that belong to a user
+func (cfg *apiConfig) resolveMentions(body string) ([]database.Mention, error) {
+	mentions := []database.Mention{}
+	for _, token := range parseMentions(body) {
+		user, err := cfg.DB.GetUserByHandle(token.Handle)
+		if errors.Is(err, database.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		mentions = append(mentions, database.Mention{
+			UserID: user.ID,
+			Start:  token.Start,
+			End:    token.End,
+		})
+	}
+
+	return mentions, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// printMigrationDryRun reports the schema migrations pending on the database file
+// without changing it
+func printMigrationDryRun(backend, path string) {
+	if backend != "json" {
+		log.Fatalf("Migration dry-run is only available for the json storage backend")
+	}
+
+	report, err := database.MigrateFile(path, true)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if report.FromVersion == report.ToVersion {
+		fmt.Printf("Database schema is up to date (version %d)\n", report.FromVersion)
+		return
+	}
+
+	fmt.Printf("Database schema would be migrated from version %d to %d\n", report.FromVersion, report.ToVersion)
+	if report.ReplayedLogEntries > 0 {
+		fmt.Printf("%d write-ahead log entries would be folded into the file first\n", report.ReplayedLogEntries)
+	}
+	for _, step := range report.Steps {
+		fmt.Printf("  %d: %s\n", step.Version, step.Description)
+		for _, change := range step.Changes {
+			fmt.Printf("     - %s\n", change)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pageParams holds the pagination query parameters of a request
+type pageParams struct {
+	// Paginated is false when neither limit nor cursor were sent
+	Paginated bool
+	Limit     int
+	Cursor    string
+}
+
+// parsePageParams reads the limit and cursor query parameters
+func parsePageParams(r *http.Request) (pageParams, error) {
+	limitString := r.URL.Query().Get("limit")
+	cursor := r.URL.Query().Get("cursor")
+
+	page := pageParams{
+		Paginated: limitString != "" || cursor != "",
+		Limit:     defaultPageLimit,
+		Cursor:    cursor,
+	}
+
+	if limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return pageParams{}, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		page.Limit = limit
+	}
+
+	return page, nil
+}
+
+// encodeCursor turns a database cursor into an opaque token for clients
+func encodeCursor(cursor any) (string, error) {
+	dat, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(dat), nil
+}
+
+// decodeCursor reads a token created by encodeCursor into cursor
+func decodeCursor(token string, cursor any) error {
+	dat, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+
+	err = json.Unmarshal(dat, cursor)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+
+	return nil
+}
+
+// setNextLink sets the Link header to the request URL with the next cursor
+func setNextLink(w http.ResponseWriter, r *http.Request, limit int, nextCursor string) {
+	query := r.URL.Query()
+	query.Set("cursor", nextCursor)
+	query.Set("limit", strconv.Itoa(limit))
+
+	next := *r.URL
+	next.RawQuery = query.Encode()
+
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+}
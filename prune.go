@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// expiringRecords lists the records deleted once they expired
+var expiringRecords = []struct {
+	name          string
+	deleteExpired func(db database.Store, before time.Time) (int, error)
+}{
+	{"sessions", database.Store.DeleteExpiredSessions},
+	{"password reset tokens", database.Store.DeleteExpiredPasswordResets},
+	{"email verification tokens", database.Store.DeleteExpiredEmailVerifications},
+}
+
+// pruneExpired deletes the expired records now and then every interval,
+// until the returned function is called. Stopping waits for a pass in progress,
+// so that the store can be closed right after.
+func pruneExpired(db database.Store, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			for _, records := range expiringRecords {
+				count, err := records.deleteExpired(db, time.Now().UTC())
+				if err != nil {
+					log.Printf("Couldn't delete expired %s: %s", records.name, err)
+				} else if count > 0 {
+					log.Printf("Deleted %d expired %s", count, records.name)
+				}
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
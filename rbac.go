@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// permission is a privileged action guarded by the role of the user
+type permission string
+
+const (
+	permissionViewMetrics  permission = "metrics:view"
+	permissionResetMetrics permission = "metrics:reset"
+	permissionModerate     permission = "reports:moderate"
+	permissionManageRoles  permission = "users:manage_roles"
+)
+
+// rolePermissions lists the permissions granted to each role
+var rolePermissions = map[database.Role][]permission{
+	database.RoleUser:      {},
+	database.RoleModerator: {permissionModerate},
+	database.RoleAdmin:     {permissionViewMetrics, permissionResetMetrics, permissionModerate, permissionManageRoles},
+}
+
+// roleHasPermission reports whether the role grants the permission
+func roleHasPermission(role database.Role, required permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == required {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestHasPermission reports whether the user authenticated for the request, if any, has the permission
+func requestHasPermission(r *http.Request, required permission) bool {
+	user, ok := optionalUser(r)
+	return ok && roleHasPermission(user.Role, required)
+}
+
+// roleScopes returns the permissions granted to the role as token scopes
+func roleScopes(role database.Role) []string {
+	scopes := []string{}
+	for _, granted := range rolePermissions[role] {
+		scopes = append(scopes, string(granted))
+	}
+
+	return scopes
+}
+
+// middlewareRequirePermission only lets through users whose role grants the permission.
+// It runs after middlewareAuth, so role changes apply to tokens already handed out.
+func (cfg *apiConfig) middlewareRequirePermission(required permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !roleHasPermission(currentUser(r).Role, required) {
+				respondWithError(w, http.StatusForbidden, "Permission denied")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bootstrapAdmin gives the admin role to the user with the email,
+// so that a fresh deployment has someone to hand out roles
+func bootstrapAdmin(db database.Store, email string) error {
+	user, err := db.GetUserByEmail(email)
+	if err != nil {
+		return fmt.Errorf("bootstrap admin %s: %w", email, err)
+	}
+	if user.Role == database.RoleAdmin {
+		return nil
+	}
+
+	_, err = db.SetUserRole(user.ID, database.RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("bootstrap admin %s: %w", email, err)
+	}
+	log.Printf("Gave the admin role to %s\n", email)
+
+	return nil
+}
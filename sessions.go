@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+// newAccessToken signs an access token of the user for the session,
+// carrying the role of the user and the permissions it grants as scopes
+func (cfg *apiConfig) newAccessToken(user database.User, sessionID string) (string, error) {
+	signedToken, _, err := cfg.tokens.Issue(auth.Claims{
+		UserID:    user.ID,
+		TokenUse:  auth.TokenUseAccess,
+		SessionID: sessionID,
+		Roles:     []string{string(user.Role)},
+		Scopes:    roleScopes(user.Role),
+	})
+
+	return signedToken, err
+}
+
+// newRefreshToken signs a refresh token with a fresh jti for the user
+// and returns it with the record tracking it
+func (cfg *apiConfig) newRefreshToken(user database.User) (database.RefreshToken, string, error) {
+	tokenID, err := auth.NewTokenID()
+	if err != nil {
+		return database.RefreshToken{}, "", err
+	}
+
+	signedToken, claims, err := cfg.tokens.Issue(auth.Claims{
+		UserID:   user.ID,
+		TokenUse: auth.TokenUseRefresh,
+		ID:       tokenID,
+	})
+	if err != nil {
+		return database.RefreshToken{}, "", err
+	}
+
+	return database.RefreshToken{
+		ID:        tokenID,
+		UserID:    user.ID,
+		ExpiresAt: claims.ExpiresAt,
+	}, signedToken, nil
+}
+
+// sessionTouchInterval is how often the use of a session by access tokens is recorded
+const sessionTouchInterval = time.Minute
+
+// maxUserAgentLength caps the user agent kept with a session
+const maxUserAgentLength = 256
+
+// newSession returns a session for a login of the user from the request
+func newSession(r *http.Request, user database.User) (database.Session, error) {
+	sessionID, err := auth.NewTokenID()
+	if err != nil {
+		return database.Session{}, err
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	return database.Session{
+		ID:        sessionID,
+		UserID:    user.ID,
+		UserAgent: userAgent,
+		IP:        clientIP(r),
+	}, nil
+}
+
+// clientIP returns the address the request came from, without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
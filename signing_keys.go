@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ric-ram/go-chirpy/internal/auth"
+)
+
+// generateSigningKey writes a new private key for the signing method to the keys directory,
+// named after a kid taken from the current time
+func generateSigningKey(dir, alg string) {
+	if dir == "" {
+		log.Fatal("Pick the directory of the key with -jwt-keys")
+	}
+
+	dat, err := auth.GenerateKey(alg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	kid := time.Now().UTC().Format("20060102T150405Z")
+	path := filepath.Join(dir, kid+".pem")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(dat)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Wrote the %s key %s to %s\n", alg, kid, path)
+	fmt.Printf("Start the server with -jwt-signing-key %s to sign tokens with it\n", kid)
+}
+
+// handlerJWKS publishes the public keys verifying the tokens,
+// so that other services can check them without the signing keys
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.tokens.JWKS())
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ric-ram/go-chirpy/internal/auth"
+	"github.com/ric-ram/go-chirpy/internal/database"
+)
+
+const (
+	// totpIssuer names chirpy in authenticator apps
+	totpIssuer = "Chirpy"
+	// totpDrift is how many time steps a code may be early or late, to bear with skewed phone clocks
+	totpDrift = 1
+	// recoveryCodeCount is how many recovery codes are handed out when enabling two-factor authentication
+	recoveryCodeCount = 10
+	// qrModulePixels is the size of a module of the enrollment QR code
+	qrModulePixels = 8
+	// maxTwoFactorFailures within twoFactorFailureWindow lock the second factor of a user,
+	// so that six digits can't be brute forced
+	maxTwoFactorFailures   = 5
+	twoFactorFailureWindow = 15 * time.Minute
+)
+
+var errInvalidTwoFactorCode = errors.New("Invalid two-factor code")
+var errTooManyTwoFactorFailures = errors.New("Too many invalid two-factor codes, try again later")
+
+// twoFactorLimiter tracks the recent failed second factors of each user
+type twoFactorLimiter struct {
+	mux      sync.Mutex
+	failures map[int][]time.Time
+}
+
+func newTwoFactorLimiter() *twoFactorLimiter {
+	return &twoFactorLimiter{
+		failures: map[int][]time.Time{},
+	}
+}
+
+// recentFailures drops the failures of the user older than the window and counts the others.
+// Callers must hold the lock.
+func (limiter *twoFactorLimiter) recentFailures(userID int, now time.Time) int {
+	recent := []time.Time{}
+	for _, at := range limiter.failures[userID] {
+		if now.Sub(at) < twoFactorFailureWindow {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) == 0 {
+		delete(limiter.failures, userID)
+	} else {
+		limiter.failures[userID] = recent
+	}
+
+	return len(recent)
+}
+
+// allowed reports whether the user may try another code
+func (limiter *twoFactorLimiter) allowed(userID int, now time.Time) bool {
+	limiter.mux.Lock()
+	defer limiter.mux.Unlock()
+
+	return limiter.recentFailures(userID, now) < maxTwoFactorFailures
+}
+
+func (limiter *twoFactorLimiter) fail(userID int, now time.Time) {
+	limiter.mux.Lock()
+	defer limiter.mux.Unlock()
+
+	limiter.recentFailures(userID, now)
+	limiter.failures[userID] = append(limiter.failures[userID], now)
+}
+
+func (limiter *twoFactorLimiter) reset(userID int) {
+	limiter.mux.Lock()
+	defer limiter.mux.Unlock()
+
+	delete(limiter.failures, userID)
+}
+
+// checkSecondFactor accepts a code of the authenticator of the user, or one of their recovery codes,
+// using it up. It returns errInvalidTwoFactorCode for a wrong or replayed code.
+func (cfg *apiConfig) checkSecondFactor(totp database.TOTP, code, recoveryCode string) error {
+	now := time.Now().UTC()
+	if !cfg.twoFactorFailures.allowed(totp.UserID, now) {
+		return errTooManyTwoFactorFailures
+	}
+
+	var err error
+	if recoveryCode != "" {
+		_, err = cfg.DB.UseRecoveryCode(totp.UserID, auth.HashRecoveryCode(recoveryCode))
+		if errors.Is(err, database.ErrNotExist) {
+			err = errInvalidTwoFactorCode
+		}
+	} else {
+		var step int64
+		step, err = auth.ValidateTOTP(totp.Secret, code, now, totpDrift, totp.LastStep)
+		if errors.Is(err, auth.ErrInvalidTOTPCode) {
+			err = errInvalidTwoFactorCode
+		}
+		if err == nil {
+			// also refuses a code replayed concurrently since totp was read
+			err = cfg.DB.UseTOTPStep(totp.UserID, step)
+			if errors.Is(err, database.ErrCodeUsed) {
+				err = errInvalidTwoFactorCode
+			}
+		}
+	}
+
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		cfg.twoFactorFailures.fail(totp.UserID, now)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg.twoFactorFailures.reset(totp.UserID)
+	return nil
+}